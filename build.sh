@@ -5,7 +5,7 @@ set -e
 echo "Building Lambda functions..."
 
 # Function names
-FUNCTIONS=("get-device" "list-devices" "create-device" "update-device" "delete-device" "sqs-listener")
+FUNCTIONS=("get-device" "get-device-history" "list-devices" "list-home-devices" "create-device" "update-device" "delete-device" "restore-device" "get-home" "list-homes" "create-home" "update-home" "delete-home" "sqs-listener" "outbox-relay" "api")
 
 # Clean previous builds
 rm -rf build
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"example.com/smart-devices/internal/apigw"
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/handlers"
+	"example.com/smart-devices/internal/router"
+	"example.com/smart-devices/internal/setup"
+	"go.uber.org/zap"
+)
+
+var (
+	deviceHandler *handlers.DeviceHandler
+	homeHandler   *handlers.HomeHandler
+	logger        *zap.Logger
+)
+
+func init() {
+	deviceHandler, homeHandler, logger = setup.SetupAPIComponents()
+}
+
+func main() {
+	apigw.Start(router.New(append(deviceHandler.Routes(), homeHandler.Routes()...), logger).Handle, appConfig.Load().APIPayloadFormat, logger)
+}
@@ -0,0 +1,319 @@
+// Command backfill-homes prepares the homes table for home reference checks.
+// Devices created before homes existed name home IDs that have no home item,
+// and every home's deviceCount has to match its active devices before device
+// writes maintain it, so such stages run with HOME_CHECKS=false until then.
+//
+// Home IDs that devices use without a home item get a placeholder home named
+// after the ID, owned by "unknown" in UTC, for an operator to rename. Every
+// home is then recounted on its own: its stored count is read first and its
+// devices are counted from the homeId index afterwards, so a device write in
+// between changes the stored count and fails the conditional update. Homes
+// changed meanwhile are reported as conflicts and a rerun picks them up.
+// Tombstoned devices and the partial items cmd/cleanup-orphans removes do
+// not count. Run once per stage with HOME_CHECKS=false, and once more right
+// after turning the checks on, to catch the devices written in between:
+//
+//	DYNAMODB_TABLE=smart-devices-dev-devices DYNAMODB_HOMES_TABLE=smart-devices-dev-homes go run ./cmd/backfill-homes -dry-run
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"flag"
+	"strconv"
+	"strings"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/clock"
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/setup"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// homeIDIndexName is the devices table index keyed by homeId
+const homeIDIndexName = "homeId-index"
+
+// requiredAttributes are written by CreateDevice and never removed; items
+// lacking any of them are the partial items cmd/cleanup-orphans deletes
+var requiredAttributes = []string{"mac", "name", "type", "createdAt"}
+
+type backfill struct {
+	client *dynamodb.Client
+	cfg    *appConfig.Config
+	logger *zap.Logger
+	dryRun bool
+	filter string
+	names  map[string]string
+
+	homes, created, recounted, conflicts, failed int
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report the homes that would be created or recounted without writing")
+	flag.Parse()
+
+	cfg := appConfig.Load()
+	logger := setup.NewLogger()
+	defer logger.Sync()
+
+	filter, names := deviceFilter()
+	b := &backfill{
+		client: setup.NewDynamoDBClient(cfg, logger),
+		cfg:    cfg,
+		logger: logger,
+		dryRun: *dryRun,
+		filter: filter,
+		names:  names,
+	}
+	ctx := context.Background()
+
+	referenced := b.referencedHomes(ctx)
+	for _, id := range b.storedHomes(ctx) {
+		delete(referenced, id)
+	}
+
+	// What is left are home IDs devices use without a home item
+	for id := range referenced {
+		b.createPlaceholder(ctx, id)
+	}
+	for _, id := range b.storedHomes(ctx) {
+		b.recount(ctx, id)
+	}
+
+	logger.Info("home backfill finished",
+		zap.Int("homes", b.homes),
+		zap.Int("created", b.created),
+		zap.Int("recounted", b.recounted),
+		zap.Int("conflicts", b.conflicts),
+		zap.Int("failed", b.failed),
+		zap.Bool("dry_run", b.dryRun),
+	)
+}
+
+// referencedHomes returns the home IDs of the devices that count
+func (b *backfill) referencedHomes(ctx context.Context) map[string]bool {
+	paginator := dynamodb.NewScanPaginator(b.client, &dynamodb.ScanInput{
+		TableName:                aws.String(b.cfg.DynamoDBTable),
+		ProjectionExpression:     aws.String("#homeId"),
+		FilterExpression:         aws.String(b.filter),
+		ExpressionAttributeNames: b.names,
+	})
+
+	homes := make(map[string]bool)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			b.logger.Fatal("failed to scan devices", zap.Error(err))
+		}
+		for _, item := range page.Items {
+			if id := stringAttribute(item, "homeId"); id != "" {
+				homes[id] = true
+			}
+		}
+	}
+	return homes
+}
+
+// storedHomes returns the IDs of the items in the homes table
+func (b *backfill) storedHomes(ctx context.Context) []string {
+	paginator := dynamodb.NewScanPaginator(b.client, &dynamodb.ScanInput{
+		TableName:            aws.String(b.cfg.HomesTable),
+		ProjectionExpression: aws.String("id"),
+	})
+
+	var ids []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			b.logger.Fatal("failed to scan homes", zap.Error(err))
+		}
+		for _, item := range page.Items {
+			if id := stringAttribute(item, "id"); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// createPlaceholder stores an empty home for a home ID without a home item.
+// recount fills in its device count afterwards; a dry run, which creates
+// nothing to recount, counts the devices here.
+func (b *backfill) createPlaceholder(ctx context.Context, id string) {
+	if b.dryRun {
+		count, err := b.countDevices(ctx, id)
+		if err != nil {
+			b.failed++
+			b.logger.Error("failed to count home devices", zap.String("home_id", id), zap.Error(err))
+			return
+		}
+		b.logger.Info("creating placeholder home", zap.String("home_id", id), zap.Int64("device_count", count), zap.Bool("dry_run", b.dryRun))
+		b.created++
+		return
+	}
+	b.logger.Info("creating placeholder home", zap.String("home_id", id), zap.Bool("dry_run", b.dryRun))
+
+	now := strconv.FormatInt(clock.NowMillis(clock.SystemClock{}), 10)
+	_, err := b.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(b.cfg.HomesTable),
+		Item: map[string]types.AttributeValue{
+			"id":          &types.AttributeValueMemberS{Value: id},
+			"name":        &types.AttributeValueMemberS{Value: id},
+			"timezone":    &types.AttributeValueMemberS{Value: "UTC"},
+			"owner":       &types.AttributeValueMemberS{Value: audit.Unknown},
+			"createdAt":   &types.AttributeValueMemberN{Value: now},
+			"modifiedAt":  &types.AttributeValueMemberN{Value: now},
+			"version":     &types.AttributeValueMemberN{Value: "1"},
+			"deviceCount": &types.AttributeValueMemberN{Value: "0"},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionFailed) {
+			// Someone created the home since the scan; it is recounted below
+			return
+		}
+
+		b.failed++
+		b.logger.Error("failed to create placeholder home", zap.String("home_id", id), zap.Error(err))
+		return
+	}
+	b.created++
+}
+
+// recount reads the stored device count of a home, then counts its devices
+// and replaces the stored count if it differs and has not changed since
+func (b *backfill) recount(ctx context.Context, id string) {
+	b.homes++
+
+	result, err := b.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(b.cfg.HomesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ProjectionExpression: aws.String("id, deviceCount"),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		b.failed++
+		b.logger.Error("failed to read home", zap.String("home_id", id), zap.Error(err))
+		return
+	}
+	if result.Item == nil {
+		// Deleted since the scan
+		return
+	}
+	current, stored := numberAttribute(result.Item, "deviceCount")
+
+	want, err := b.countDevices(ctx, id)
+	if err != nil {
+		b.failed++
+		b.logger.Error("failed to count home devices", zap.String("home_id", id), zap.Error(err))
+		return
+	}
+	if stored && current == want {
+		return
+	}
+
+	b.logger.Info("recounting home devices",
+		zap.String("home_id", id),
+		zap.Int64("device_count", want),
+		zap.Bool("dry_run", b.dryRun),
+	)
+	if b.dryRun {
+		b.recounted++
+		return
+	}
+
+	condition := "attribute_exists(id) AND attribute_not_exists(#deviceCount)"
+	values := map[string]types.AttributeValue{
+		":count": &types.AttributeValueMemberN{Value: strconv.FormatInt(want, 10)},
+	}
+	if stored {
+		condition = "attribute_exists(id) AND #deviceCount = :stored"
+		values[":stored"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(current, 10)}
+	}
+	_, err = b.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(b.cfg.HomesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:          aws.String("SET #deviceCount = :count"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#deviceCount": "deviceCount"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionFailed) {
+			b.conflicts++
+			b.logger.Warn("home not recounted, deleted or its devices changed while counting", zap.String("home_id", id), zap.Error(err))
+			return
+		}
+
+		b.failed++
+		b.logger.Error("failed to recount home devices", zap.String("home_id", id), zap.Error(err))
+		return
+	}
+	b.recounted++
+}
+
+// countDevices counts the devices of a home that count towards it
+func (b *backfill) countDevices(ctx context.Context, homeID string) (int64, error) {
+	paginator := dynamodb.NewQueryPaginator(b.client, &dynamodb.QueryInput{
+		TableName:                aws.String(b.cfg.DynamoDBTable),
+		IndexName:                aws.String(homeIDIndexName),
+		KeyConditionExpression:   aws.String("#homeId = :homeId"),
+		FilterExpression:         aws.String(b.filter),
+		ExpressionAttributeNames: b.names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":homeId": &types.AttributeValueMemberS{Value: homeID},
+		},
+		Select: types.SelectCount,
+	})
+
+	var count int64
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		count += int64(page.Count)
+	}
+	return count, nil
+}
+
+// deviceFilter matches active devices holding a home ID and every attribute
+// a device is created with. Names are placeholders since name and type are
+// DynamoDB reserved words.
+func deviceFilter() (string, map[string]string) {
+	conditions := []string{"attribute_exists(#homeId)", "attribute_not_exists(#deletedAt)"}
+	names := map[string]string{"#homeId": "homeId", "#deletedAt": "deletedAt"}
+	for _, name := range requiredAttributes {
+		placeholder := "#" + name
+		conditions = append(conditions, "attribute_exists("+placeholder+")")
+		names[placeholder] = name
+	}
+	return strings.Join(conditions, " AND "), names
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+// numberAttribute returns the integer stored under name and whether it is set
+func numberAttribute(item map[string]types.AttributeValue, name string) (int64, bool) {
+	value, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value.Value, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,177 @@
+// Command backfill-macs registers the MACs of devices created before MAC
+// uniqueness was enforced in the MAC lookup table. Until a device's MAC has a
+// lookup item, CreateDevice cannot see it and accepts the same MAC again.
+//
+// Each device is claimed in a transaction that also checks the device is
+// still active and still holds the scanned MAC, so a device deleted or
+// changed meanwhile is not registered. MACs already claimed by another device
+// are reported as duplicates and left alone for an operator to resolve. Run
+// once per stage, after deploying the build that enforces uniqueness:
+//
+//	DYNAMODB_TABLE=smart-devices-dev-devices DYNAMODB_MAC_TABLE=smart-devices-dev-device-macs go run ./cmd/backfill-macs -dry-run
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"flag"
+
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/setup"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report the MACs that would be registered without writing")
+	flag.Parse()
+
+	cfg := appConfig.Load()
+	logger := setup.NewLogger()
+	defer logger.Sync()
+
+	client := setup.NewDynamoDBClient(cfg, logger)
+	ctx := context.Background()
+
+	// Tombstoned devices have released their MAC and are skipped
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName:            aws.String(cfg.DynamoDBTable),
+		ProjectionExpression: aws.String("id, mac"),
+		FilterExpression:     aws.String("attribute_exists(mac) AND attribute_not_exists(deletedAt)"),
+	})
+
+	var scanned, registered, duplicates, failed int
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Fatal("failed to scan devices", zap.Error(err))
+		}
+
+		for _, item := range page.Items {
+			scanned++
+
+			id, storedMAC := stringAttribute(item, "id"), stringAttribute(item, "mac")
+			mac := models.NormalizeMAC(storedMAC)
+			if id == "" || mac == "" {
+				continue
+			}
+
+			owner, err := lookupOwner(ctx, client, cfg.MACTable, mac)
+			if err != nil {
+				failed++
+				logger.Error("failed to read MAC lookup item", zap.String("device_id", id), zap.String("device_mac", mac), zap.Error(err))
+				continue
+			}
+			if owner == id {
+				continue
+			}
+			if owner != "" {
+				duplicates++
+				logger.Warn("MAC already registered to another device",
+					zap.String("device_id", id),
+					zap.String("device_mac", mac),
+					zap.String("owner_device_id", owner),
+				)
+				continue
+			}
+
+			logger.Info("registering device MAC",
+				zap.String("device_id", id),
+				zap.String("device_mac", mac),
+				zap.Bool("dry_run", *dryRun),
+			)
+			if *dryRun {
+				registered++
+				continue
+			}
+
+			_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: []types.TransactWriteItem{
+					{
+						ConditionCheck: &types.ConditionCheck{
+							TableName: aws.String(cfg.DynamoDBTable),
+							Key: map[string]types.AttributeValue{
+								"id": &types.AttributeValueMemberS{Value: id},
+							},
+							ConditionExpression: aws.String("#mac = :storedMac AND attribute_not_exists(#deletedAt)"),
+							ExpressionAttributeNames: map[string]string{
+								"#mac":       "mac",
+								"#deletedAt": "deletedAt",
+							},
+							ExpressionAttributeValues: map[string]types.AttributeValue{
+								":storedMac": &types.AttributeValueMemberS{Value: storedMAC},
+							},
+						},
+					},
+					{
+						Put: &types.Put{
+							TableName: aws.String(cfg.MACTable),
+							Item: map[string]types.AttributeValue{
+								"mac":      &types.AttributeValueMemberS{Value: mac},
+								"deviceId": &types.AttributeValueMemberS{Value: id},
+							},
+							ConditionExpression: aws.String("attribute_not_exists(mac)"),
+						},
+					},
+				},
+			})
+			if err != nil {
+				var canceled *types.TransactionCanceledException
+				if stderrors.As(err, &canceled) {
+					// The device changed or another device claimed the MAC
+					// since the scan; a rerun picks up whatever is left
+					duplicates++
+					logger.Warn("MAC not registered, device or lookup item changed since the scan",
+						zap.String("device_id", id),
+						zap.String("device_mac", mac),
+						zap.Error(err),
+					)
+					continue
+				}
+
+				failed++
+				logger.Error("failed to register device MAC",
+					zap.String("device_id", id),
+					zap.String("device_mac", mac),
+					zap.Error(err),
+				)
+				continue
+			}
+			registered++
+		}
+	}
+
+	logger.Info("MAC backfill finished",
+		zap.Int("scanned", scanned),
+		zap.Int("registered", registered),
+		zap.Int("duplicates", duplicates),
+		zap.Int("failed", failed),
+		zap.Bool("dry_run", *dryRun),
+	)
+}
+
+// lookupOwner returns the ID of the device the MAC lookup item names, or ""
+// when the MAC is not registered
+func lookupOwner(ctx context.Context, client *dynamodb.Client, tableName string, mac string) (string, error) {
+	result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tableName),
+		Key: map[string]types.AttributeValue{
+			"mac": &types.AttributeValueMemberS{Value: mac},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return stringAttribute(result.Item, "deviceId"), nil
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+// Command cleanup-orphans finds partial device items created by older builds
+// whose UpdateDeviceHomeID upserted unknown device IDs. Those items only hold
+// id, homeId, modifiedAt (and version) and are missing every attribute a
+// device is created with. By default they are only reported:
+//
+//	DYNAMODB_TABLE=smart-devices-dev-devices go run ./cmd/cleanup-orphans
+//	DYNAMODB_TABLE=smart-devices-dev-devices go run ./cmd/cleanup-orphans -delete
+//
+// Deleting an item leaves the deviceCount of its home untouched, since the
+// count may or may not include it. Rerun cmd/backfill-homes afterwards to
+// recount the homes of deleted items that held a homeId.
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/setup"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// requiredAttributes are written by CreateDevice and never removed, so an
+// item lacking any of them was not created as a device
+var requiredAttributes = []string{"mac", "name", "type", "createdAt"}
+
+func main() {
+	deleteOrphans := flag.Bool("delete", false, "delete the orphaned items instead of only reporting them")
+	flag.Parse()
+
+	cfg := appConfig.Load()
+	logger := setup.NewLogger()
+	defer logger.Sync()
+
+	client := setup.NewDynamoDBClient(cfg, logger)
+	ctx := context.Background()
+
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName: aws.String(cfg.DynamoDBTable),
+	})
+
+	condition, names := partialCondition()
+
+	var scanned, orphans, deleted, homed, failed int
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Fatal("failed to scan devices", zap.Error(err))
+		}
+
+		for _, item := range page.Items {
+			scanned++
+
+			missing := missingAttributes(item)
+			if len(missing) == 0 {
+				continue
+			}
+			orphans++
+
+			id := stringAttribute(item, "id")
+			logger.Warn("orphaned device item",
+				zap.String("device_id", id),
+				zap.String("home_id", stringAttribute(item, "homeId")),
+				zap.Strings("missing_attributes", missing),
+				zap.Bool("delete", *deleteOrphans),
+			)
+			if !*deleteOrphans {
+				continue
+			}
+
+			// Only delete while the item is still partial
+			_, err := client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(cfg.DynamoDBTable),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: id},
+				},
+				ConditionExpression:      aws.String(condition),
+				ExpressionAttributeNames: names,
+			})
+			if err != nil {
+				failed++
+				logger.Error("failed to delete orphaned device item",
+					zap.String("device_id", id),
+					zap.Error(err),
+				)
+				continue
+			}
+			deleted++
+			if stringAttribute(item, "homeId") != "" {
+				homed++
+			}
+		}
+	}
+
+	logger.Info("orphan cleanup finished",
+		zap.Int("scanned", scanned),
+		zap.Int("orphans", orphans),
+		zap.Int("deleted", deleted),
+		zap.Int("failed", failed),
+		zap.Bool("delete", *deleteOrphans),
+	)
+	if homed > 0 {
+		logger.Warn("deleted items held a home ID, rerun backfill-homes to recount their homes", zap.Int("with_home", homed))
+	}
+}
+
+func missingAttributes(item map[string]types.AttributeValue) []string {
+	var missing []string
+	for _, name := range requiredAttributes {
+		if _, ok := item[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// partialCondition matches items lacking any of requiredAttributes, the same
+// test missingAttributes applies to scanned items. Names are placeholders
+// since name and type are DynamoDB reserved words.
+func partialCondition() (string, map[string]string) {
+	conditions := make([]string, 0, len(requiredAttributes))
+	names := make(map[string]string, len(requiredAttributes))
+	for _, name := range requiredAttributes {
+		placeholder := "#" + name
+		conditions = append(conditions, "attribute_not_exists("+placeholder+")")
+		names[placeholder] = name
+	}
+	return strings.Join(conditions, " OR "), names
+}
+
+func stringAttribute(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"example.com/smart-devices/internal/apigw"
+	appConfig "example.com/smart-devices/internal/config"
 	"example.com/smart-devices/internal/handlers"
 	"example.com/smart-devices/internal/setup"
-	"github.com/aws/aws-lambda-go/lambda"
 	"go.uber.org/zap"
 )
 
@@ -19,5 +20,5 @@ func init() {
 func main() {
 	logger.Info("starting delete-device")
 
-	lambda.Start(deviceHandler.DeleteDevice)
+	apigw.Start(deviceHandler.DeleteDevice, appConfig.Load().APIPayloadFormat, logger)
 }
@@ -0,0 +1,149 @@
+// Command dlq inspects and redrives the device notification dead-letter queue.
+//
+//	dlq list [-max N]              print DLQ messages with their decoded SQSMessage
+//	dlq replay <message-id>...     re-run messages through SQSService in dry-run mode
+//	dlq redrive <message-id>...    move messages back to the main queue
+//	dlq redrive -all               move every DLQ message back to the main queue
+//
+// Queues come from SQS_DLQ_URL and SQS_QUEUE_URL; set SQS_ENDPOINT to use a
+// local SQS stand-in such as ElasticMQ or LocalStack:
+//
+//	SQS_ENDPOINT=http://localhost:9324 SQS_DLQ_URL=... go run ./cmd/dlq list
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"example.com/smart-devices/internal/clock"
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/dlq"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/repository"
+	"example.com/smart-devices/internal/repository/dryrun"
+	"example.com/smart-devices/internal/repository/memory"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/internal/setup"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg := appConfig.Load()
+	logger := setup.NewLogger()
+	defer logger.Sync()
+
+	if cfg.DLQURL == "" {
+		logger.Fatal("SQS_DLQ_URL must be set")
+	}
+
+	client := dlq.NewClient(setup.NewSQSClient(cfg, logger), cfg.DLQURL, cfg.SQSQueueURL, logger)
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ExitOnError)
+		max := flags.Int("max", 0, "maximum number of messages to list (0 lists all)")
+		flags.Parse(os.Args[2:])
+
+		messages, err := client.List(ctx, *max)
+		if err != nil {
+			logger.Fatal("failed to list DLQ messages", zap.Error(err))
+		}
+		printJSON(messages)
+
+	case "replay":
+		flags := flag.NewFlagSet("replay", flag.ExitOnError)
+		flags.Parse(os.Args[2:])
+		if flags.NArg() == 0 {
+			usage()
+		}
+
+		sqsService := services.NewSQSService(services.NewDeviceService(newDryRunRepository(cfg, logger), logger,
+			services.WithHomes(newHomeRepository(cfg, logger))), nil, logger)
+		results, err := client.Replay(ctx, flags.Args(), sqsService.ProcessMessage)
+		if err != nil {
+			logger.Fatal("failed to replay DLQ messages", zap.Error(err))
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+				logger.Warn("replay failed", zap.String("message-id", result.ID), zap.Error(result.Err))
+				continue
+			}
+			logger.Info("replay succeeded", zap.String("message-id", result.ID))
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+	case "redrive":
+		flags := flag.NewFlagSet("redrive", flag.ExitOnError)
+		all := flags.Bool("all", false, "redrive every DLQ message")
+		flags.Parse(os.Args[2:])
+		if *all == (flags.NArg() > 0) {
+			usage()
+		}
+		if cfg.SQSQueueURL == "" {
+			logger.Fatal("SQS_QUEUE_URL must be set")
+		}
+
+		redriven, err := client.Redrive(ctx, flags.Args())
+		logger.Info("redrive finished", zap.Strings("redriven", redriven))
+		if err != nil {
+			logger.Fatal("failed to redrive DLQ messages", zap.Error(err))
+		}
+
+	default:
+		usage()
+	}
+}
+
+// newDryRunRepository reads devices from the configured backend without
+// writing to it
+func newDryRunRepository(cfg *appConfig.Config, logger *zap.Logger) services.DeviceRepository {
+	var repo services.DeviceRepository
+	if cfg.StorageBackend == appConfig.StorageMemory {
+		repo = memory.NewDeviceRepository(clock.SystemClock{}, idgen.UUIDGenerator{}, logger)
+	} else {
+		repo = repository.NewDeviceRepository(setup.NewDynamoDBClient(cfg, logger), cfg.DynamoDBTable, cfg.MACTable, clock.SystemClock{}, idgen.UUIDGenerator{}, logger)
+	}
+	return dryrun.NewDeviceRepository(repo, logger)
+}
+
+// newHomeRepository reads homes from the configured backend so replays reject
+// devices assigned to unknown homes. Replays only look homes up. Nothing is
+// checked while HOME_CHECKS is off, nor on the memory backend, whose homes
+// live in the process that created them and would reject every home here.
+func newHomeRepository(cfg *appConfig.Config, logger *zap.Logger) services.HomeRepository {
+	if !cfg.HomeChecks {
+		return nil
+	}
+	if cfg.StorageBackend == appConfig.StorageMemory {
+		logger.Warn("Not checking home references, the memory backend has no homes to replay against")
+		return nil
+	}
+	return repository.NewHomeRepository(setup.NewDynamoDBClient(cfg, logger), cfg.HomesTable, clock.SystemClock{}, idgen.UUIDGenerator{}, logger)
+}
+
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list [-max N] | dlq replay <message-id>... | dlq redrive (-all | <message-id>...)")
+	os.Exit(2)
+}
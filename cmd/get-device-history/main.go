@@ -0,0 +1,22 @@
+package main
+
+import (
+	"example.com/smart-devices/internal/apigw"
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/handlers"
+	"example.com/smart-devices/internal/setup"
+	"go.uber.org/zap"
+)
+
+var (
+	deviceHandler *handlers.DeviceHandler
+	logger        *zap.Logger
+)
+
+func init() {
+	deviceHandler, _, logger = setup.SetupComponents()
+}
+
+func main() {
+	apigw.Start(deviceHandler.GetDeviceHistory, appConfig.Load().APIPayloadFormat, logger)
+}
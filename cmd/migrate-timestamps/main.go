@@ -0,0 +1,147 @@
+// Command migrate-timestamps rewrites device createdAt/modifiedAt values that
+// were stored in Unix seconds into Unix milliseconds.
+//
+// Older builds wrote modifiedAt with second resolution on update, so those
+// values can be smaller than createdAt. Items missing either timestamp are
+// skipped and reported rather than rewritten. Run once per stage:
+//
+//	DYNAMODB_TABLE=smart-devices-dev-devices go run ./cmd/migrate-timestamps -dry-run
+package main
+
+import (
+	"context"
+	"flag"
+	"strconv"
+
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/setup"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// secondsThreshold separates the two resolutions: any timestamp below it is
+// in seconds (1e11 ms is March 1973, 1e11 s is thousands of years away)
+const secondsThreshold = int64(100_000_000_000)
+
+type timestamps struct {
+	ID         string `dynamodbav:"id"`
+	CreatedAt  int64  `dynamodbav:"createdAt"`
+	ModifiedAt int64  `dynamodbav:"modifiedAt"`
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report affected devices without writing")
+	flag.Parse()
+
+	cfg := appConfig.Load()
+	logger := setup.NewLogger()
+	defer logger.Sync()
+
+	client := setup.NewDynamoDBClient(cfg, logger)
+	ctx := context.Background()
+
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName:            aws.String(cfg.DynamoDBTable),
+		ProjectionExpression: aws.String("id, createdAt, modifiedAt"),
+	})
+
+	var scanned, migrated, skipped, failed int
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Fatal("failed to scan devices", zap.Error(err))
+		}
+
+		for _, item := range page.Items {
+			scanned++
+
+			var ts timestamps
+			if err := attributevalue.UnmarshalMap(item, &ts); err != nil {
+				logger.Warn("skipping malformed item", zap.Error(err))
+				continue
+			}
+
+			// Partial items (see cmd/cleanup-orphans) lack a timestamp, and
+			// rewriting them would store the missing one as 0
+			if _, ok := item["createdAt"]; !ok {
+				skipped++
+				logger.Warn("skipping item without createdAt", zap.String("device_id", ts.ID))
+				continue
+			}
+			if _, ok := item["modifiedAt"]; !ok {
+				skipped++
+				logger.Warn("skipping item without modifiedAt", zap.String("device_id", ts.ID))
+				continue
+			}
+
+			createdAt, modifiedAt := toMillis(ts.CreatedAt), toMillis(ts.ModifiedAt)
+			if createdAt == ts.CreatedAt && modifiedAt == ts.ModifiedAt {
+				continue
+			}
+
+			logger.Info("migrating device timestamps",
+				zap.String("device_id", ts.ID),
+				zap.Int64("created_at", ts.CreatedAt),
+				zap.Int64("modified_at", ts.ModifiedAt),
+				zap.Int64("new_created_at", createdAt),
+				zap.Int64("new_modified_at", modifiedAt),
+				zap.Bool("dry_run", *dryRun),
+			)
+			if *dryRun {
+				migrated++
+				continue
+			}
+
+			// Only rewrite if nothing touched the item since it was scanned
+			_, err := client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(cfg.DynamoDBTable),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: ts.ID},
+				},
+				UpdateExpression:    aws.String("SET #createdAt = :createdAt, #modifiedAt = :modifiedAt"),
+				ConditionExpression: aws.String("#createdAt = :oldCreatedAt AND #modifiedAt = :oldModifiedAt"),
+				ExpressionAttributeNames: map[string]string{
+					"#createdAt":  "createdAt",
+					"#modifiedAt": "modifiedAt",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":createdAt":     number(createdAt),
+					":modifiedAt":    number(modifiedAt),
+					":oldCreatedAt":  number(ts.CreatedAt),
+					":oldModifiedAt": number(ts.ModifiedAt),
+				},
+			})
+			if err != nil {
+				failed++
+				logger.Error("failed to migrate device timestamps",
+					zap.String("device_id", ts.ID),
+					zap.Error(err),
+				)
+				continue
+			}
+			migrated++
+		}
+	}
+
+	logger.Info("timestamp migration finished",
+		zap.Int("scanned", scanned),
+		zap.Int("migrated", migrated),
+		zap.Int("skipped", skipped),
+		zap.Int("failed", failed),
+		zap.Bool("dry_run", *dryRun),
+	)
+}
+
+func toMillis(ts int64) int64 {
+	if ts > 0 && ts < secondsThreshold {
+		return ts * 1000
+	}
+	return ts
+}
+
+func number(v int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"example.com/smart-devices/internal/outbox"
+	"example.com/smart-devices/internal/setup"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+)
+
+var (
+	relay  *outbox.Relay
+	logger *zap.Logger
+)
+
+func init() {
+	relay, logger = setup.SetupOutboxRelay()
+}
+
+func main() {
+	lambda.Start(relay.HandleStream)
+}
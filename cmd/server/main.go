@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/handlers"
+	"example.com/smart-devices/internal/httpserver"
+	"example.com/smart-devices/internal/setup"
+	"go.uber.org/zap"
+)
+
+var (
+	deviceHandler *handlers.DeviceHandler
+	homeHandler   *handlers.HomeHandler
+	logger        *zap.Logger
+)
+
+func init() {
+	deviceHandler, homeHandler, logger = setup.SetupAPIComponents()
+}
+
+func main() {
+	cfg := appConfig.Load()
+
+	server := &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           httpserver.NewHandler(append(deviceHandler.Routes(), homeHandler.Routes()...), logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		logger.Info("starting http server", zap.String("addr", cfg.HTTPAddr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("http server failed", zap.Error(err))
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	logger.Info("shutting down http server")
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("http server shutdown failed", zap.Error(err))
+	}
+}
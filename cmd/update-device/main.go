@@ -1,9 +1,10 @@
 package main
 
 import (
+	"example.com/smart-devices/internal/apigw"
+	appConfig "example.com/smart-devices/internal/config"
 	"example.com/smart-devices/internal/handlers"
 	"example.com/smart-devices/internal/setup"
-	"github.com/aws/aws-lambda-go/lambda"
 	"go.uber.org/zap"
 )
 
@@ -17,5 +18,5 @@ func init() {
 }
 
 func main() {
-	lambda.Start(deviceHandler.UpdateDevice)
+	apigw.Start(deviceHandler.UpdateDevice, appConfig.Load().APIPayloadFormat, logger)
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"example.com/smart-devices/internal/apigw"
+	appConfig "example.com/smart-devices/internal/config"
+	"example.com/smart-devices/internal/handlers"
+	"example.com/smart-devices/internal/setup"
+	"go.uber.org/zap"
+)
+
+var (
+	homeHandler *handlers.HomeHandler
+	logger      *zap.Logger
+)
+
+func init() {
+	_, homeHandler, logger = setup.SetupAPIComponents()
+}
+
+func main() {
+	apigw.Start(homeHandler.UpdateHome, appConfig.Load().APIPayloadFormat, logger)
+}
@@ -0,0 +1,212 @@
+// Package apigw adapts the different Lambda HTTP event payloads to the
+// API Gateway REST (v1) request/response types that DeviceHandler, the router
+// and the HTTP server all share, so handler logic stays payload-agnostic.
+package apigw
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"example.com/smart-devices/internal/handlers"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.uber.org/zap"
+)
+
+// Supported payload formats, selected per entrypoint via API_PAYLOAD_FORMAT
+const (
+	// PayloadV1 is the API Gateway REST API (and HTTP API 1.0) payload
+	PayloadV1 = "v1"
+	// PayloadV2 is the API Gateway HTTP API 2.0 payload
+	PayloadV2 = "v2"
+	// PayloadFunctionURL is the Lambda Function URL payload
+	PayloadFunctionURL = "url"
+)
+
+// Start starts the Lambda runtime with h wrapped for the given payload format
+func Start(h handlers.APIHandlerFunc, format string, logger *zap.Logger) {
+	switch format {
+	case PayloadV1, "":
+		lambda.Start(h)
+	case PayloadV2:
+		lambda.Start(V2(h))
+	case PayloadFunctionURL:
+		lambda.Start(FunctionURL(h))
+	default:
+		logger.Fatal("unknown API payload format", zap.String("format", format))
+	}
+}
+
+// V2 serves h from API Gateway HTTP API (payload 2.0) events
+func V2(h handlers.APIHandlerFunc) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		response, err := h(ctx, FromV2Request(request))
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{}, err
+		}
+		return ToV2Response(response), nil
+	}
+}
+
+// FunctionURL serves h from Lambda Function URL events. Function URLs do not
+// resolve routes, so h is normally a router.Router's Handle method.
+func FunctionURL(h handlers.APIHandlerFunc) func(context.Context, events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return func(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+		response, err := h(ctx, FromFunctionURLRequest(request))
+		if err != nil {
+			return events.LambdaFunctionURLResponse{}, err
+		}
+		return ToFunctionURLResponse(response), nil
+	}
+}
+
+// FromV2Request converts an HTTP API 2.0 request. The route key
+// ("GET /devices/{id}") provides the resource; "$default" and proxy routes
+// leave the router to match on the path.
+func FromV2Request(request events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+	resource := request.RouteKey
+	if i := strings.Index(resource, " "); i >= 0 {
+		resource = resource[i+1:]
+	}
+
+	authorizer, identity := fromV2Authorizer(request.RequestContext.Authorizer)
+
+	return events.APIGatewayProxyRequest{
+		Resource:              resource,
+		Path:                  request.RawPath,
+		HTTPMethod:            request.RequestContext.HTTP.Method,
+		Headers:               withCookies(request.Headers, request.Cookies),
+		QueryStringParameters: request.QueryStringParameters,
+		PathParameters:        request.PathParameters,
+		StageVariables:        request.StageVariables,
+		Body:                  decodeBody(request.Body, request.IsBase64Encoded),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  request.RequestContext.AccountID,
+			Stage:      request.RequestContext.Stage,
+			RequestID:  request.RequestContext.RequestID,
+			DomainName: request.RequestContext.DomainName,
+			APIID:      request.RequestContext.APIID,
+			HTTPMethod: request.RequestContext.HTTP.Method,
+			Path:       request.RequestContext.HTTP.Path,
+			Authorizer: authorizer,
+			Identity:   identity,
+		},
+	}
+}
+
+// fromV2Authorizer maps HTTP API authorizer output to the v1 shape: Lambda
+// authorizer context as is, JWT claims under "claims" and the IAM caller as
+// the identity
+func fromV2Authorizer(authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription) (map[string]interface{}, events.APIGatewayRequestIdentity) {
+	var identity events.APIGatewayRequestIdentity
+	if authorizer == nil {
+		return nil, identity
+	}
+
+	v1 := make(map[string]interface{}, len(authorizer.Lambda)+1)
+	for k, v := range authorizer.Lambda {
+		v1[k] = v
+	}
+	if authorizer.JWT != nil {
+		claims := make(map[string]interface{}, len(authorizer.JWT.Claims))
+		for k, v := range authorizer.JWT.Claims {
+			claims[k] = v
+		}
+		v1["claims"] = claims
+	}
+	if authorizer.IAM != nil {
+		identity.AccountID = authorizer.IAM.AccountID
+		identity.Caller = authorizer.IAM.CallerID
+		identity.User = authorizer.IAM.UserID
+		identity.UserArn = authorizer.IAM.UserARN
+	}
+
+	return v1, identity
+}
+
+// FromFunctionURLRequest converts a Lambda Function URL request
+func FromFunctionURLRequest(request events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	var identity events.APIGatewayRequestIdentity
+	if authorizer := request.RequestContext.Authorizer; authorizer != nil && authorizer.IAM != nil {
+		identity.AccountID = authorizer.IAM.AccountID
+		identity.Caller = authorizer.IAM.CallerID
+		identity.User = authorizer.IAM.UserID
+		identity.UserArn = authorizer.IAM.UserARN
+	}
+
+	return events.APIGatewayProxyRequest{
+		Path:                  request.RawPath,
+		HTTPMethod:            request.RequestContext.HTTP.Method,
+		Headers:               withCookies(request.Headers, request.Cookies),
+		QueryStringParameters: request.QueryStringParameters,
+		Body:                  decodeBody(request.Body, request.IsBase64Encoded),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:  request.RequestContext.AccountID,
+			RequestID:  request.RequestContext.RequestID,
+			DomainName: request.RequestContext.DomainName,
+			APIID:      request.RequestContext.APIID,
+			HTTPMethod: request.RequestContext.HTTP.Method,
+			Path:       request.RequestContext.HTTP.Path,
+			Identity:   identity,
+		},
+	}
+}
+
+// ToV2Response converts a handler response to an HTTP API 2.0 response
+func ToV2Response(response events.APIGatewayProxyResponse) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:        response.StatusCode,
+		Headers:           response.Headers,
+		MultiValueHeaders: response.MultiValueHeaders,
+		Body:              response.Body,
+		IsBase64Encoded:   response.IsBase64Encoded,
+	}
+}
+
+// ToFunctionURLResponse converts a handler response to a Function URL
+// response, which has no multi-value headers; repeated values are joined
+func ToFunctionURLResponse(response events.APIGatewayProxyResponse) events.LambdaFunctionURLResponse {
+	headers := make(map[string]string, len(response.Headers)+len(response.MultiValueHeaders))
+	for name, value := range response.Headers {
+		headers[name] = value
+	}
+	for name, values := range response.MultiValueHeaders {
+		headers[name] = strings.Join(values, ",")
+	}
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      response.StatusCode,
+		Headers:         headers,
+		Body:            response.Body,
+		IsBase64Encoded: response.IsBase64Encoded,
+	}
+}
+
+// withCookies restores the Cookie header that payload 2.0 moves into a
+// separate field
+func withCookies(headers map[string]string, cookies []string) map[string]string {
+	if len(cookies) == 0 {
+		return headers
+	}
+
+	merged := make(map[string]string, len(headers)+1)
+	for name, value := range headers {
+		merged[name] = value
+	}
+	merged["cookie"] = strings.Join(cookies, "; ")
+	return merged
+}
+
+// decodeBody returns the request body as text; handlers only accept JSON
+func decodeBody(body string, isBase64Encoded bool) string {
+	if !isBase64Encoded {
+		return body
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		// Leave it to JSON validation to reject the body
+		return body
+	}
+	return string(decoded)
+}
@@ -0,0 +1,88 @@
+package apigw
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestV2_ConvertsRequestAndResponse(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	h := V2(func(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		got = request
+		return events.APIGatewayProxyResponse{
+			StatusCode: 200,
+			Headers:    map[string]string{"ETag": `"2"`},
+			Body:       `{"ok":true}`,
+		}, nil
+	})
+
+	request := events.APIGatewayV2HTTPRequest{
+		RouteKey:              "PUT /devices/{id}",
+		RawPath:               "/devices/abc",
+		Headers:               map[string]string{"if-match": `"1"`},
+		QueryStringParameters: map[string]string{"limit": "5"},
+		PathParameters:        map[string]string{"id": "abc"},
+		Body:                  base64.StdEncoding.EncodeToString([]byte(`{"name":"x"}`)),
+		IsBase64Encoded:       true,
+	}
+	request.RequestContext.HTTP.Method = "PUT"
+	request.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "user-1"}},
+	}
+
+	response, err := h(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if got.HTTPMethod != "PUT" || got.Resource != "/devices/{id}" || got.Path != "/devices/abc" {
+		t.Errorf("Unexpected method/resource/path: %s %s %s", got.HTTPMethod, got.Resource, got.Path)
+	}
+	if got.PathParameters["id"] != "abc" || got.QueryStringParameters["limit"] != "5" || got.Headers["if-match"] != `"1"` {
+		t.Errorf("Expected parameters and headers to be passed through, got %+v", got)
+	}
+	if got.Body != `{"name":"x"}` {
+		t.Errorf("Expected base64 body to be decoded, got %q", got.Body)
+	}
+	if claims, ok := got.RequestContext.Authorizer["claims"].(map[string]interface{}); !ok || claims["sub"] != "user-1" {
+		t.Errorf("Expected JWT claims under the authorizer, got %+v", got.RequestContext.Authorizer)
+	}
+	if response.StatusCode != 200 || response.Headers["ETag"] != `"2"` || response.Body != `{"ok":true}` {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestFunctionURL_ConvertsRequestAndResponse(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	h := FunctionURL(func(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		got = request
+		return events.APIGatewayProxyResponse{
+			StatusCode:        405,
+			MultiValueHeaders: map[string][]string{"Allow": {"GET", "PUT"}},
+		}, nil
+	})
+
+	request := events.LambdaFunctionURLRequest{
+		RawPath: "/devices/abc",
+		Cookies: []string{"a=1", "b=2"},
+	}
+	request.RequestContext.HTTP.Method = "DELETE"
+
+	response, err := h(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if got.HTTPMethod != "DELETE" || got.Path != "/devices/abc" || got.Resource != "" {
+		t.Errorf("Unexpected method/resource/path: %s %q %s", got.HTTPMethod, got.Resource, got.Path)
+	}
+	if got.Headers["cookie"] != "a=1; b=2" {
+		t.Errorf("Expected cookies to be restored as a header, got %q", got.Headers["cookie"])
+	}
+	if response.StatusCode != 405 || response.Headers["Allow"] != "GET,PUT" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
@@ -0,0 +1,33 @@
+// Package audit carries who is making a change, and through which
+// entrypoint, from the handlers to the device repositories, which record it
+// in the change history.
+package audit
+
+import "context"
+
+// Unknown is used for changes made without an actor in the context, e.g.
+// from one-off commands
+const Unknown = "unknown"
+
+// Actor identifies who made a change. Source is models.SourceHTTP or
+// models.SourceSQS.
+type Actor struct {
+	ID     string
+	Source string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// FromContext returns the actor stored by WithActor, or Unknown for both ID
+// and source
+func FromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{ID: Unknown, Source: Unknown}
+}
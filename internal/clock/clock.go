@@ -0,0 +1,23 @@
+package clock
+
+import "time"
+
+// Clock abstracts the current time so timestamps written by the
+// repositories can be controlled and kept consistent
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock backed by the wall clock
+type SystemClock struct{}
+
+// Now returns the current wall clock time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NowMillis returns the current time of c as Unix milliseconds, the unit used
+// for every createdAt/modifiedAt attribute
+func NowMillis(c Clock) int64 {
+	return c.Now().UnixMilli()
+}
@@ -2,23 +2,94 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// StorageDynamoDB stores devices in DynamoDB (the default)
+	StorageDynamoDB = "dynamodb"
+	// StorageMemory keeps devices in process memory; data is lost on restart
+	StorageMemory = "memory"
+)
+
+const (
+	// PublisherNone disables device lifecycle events (the default)
+	PublisherNone = "none"
+	// PublisherSQS sends device lifecycle events to EventsQueueURL
+	PublisherSQS = "sqs"
+	// PublisherMemory keeps device lifecycle events in process memory
+	PublisherMemory = "memory"
 )
 
 type Config struct {
-	DynamoDBTable string
-	SQSQueueURL   string
-	AWSRegion     string
-	Stage         string
-	DynamoDBURL   string
+	DynamoDBTable  string
+	MACTable       string
+	SQSQueueURL    string
+	AWSRegion      string
+	Stage          string
+	DynamoDBURL    string
+	StorageBackend string
+	HTTPAddr       string
+	// APIPayloadFormat selects the HTTP event payload an entrypoint accepts:
+	// "v1" (REST API), "v2" (HTTP API) or "url" (Lambda Function URL)
+	APIPayloadFormat string
+	// DedupTable records processed SQS messages; DedupLease bounds how long an
+	// in-flight claim blocks redeliveries and DedupRetention how long a
+	// processed message is remembered
+	DedupTable     string
+	DedupLease     time.Duration
+	DedupRetention time.Duration
+	// DLQURL is the dead-letter queue of SQSQueueURL; SQSEndpoint overrides
+	// the SQS endpoint for a local stand-in (ElasticMQ, LocalStack)
+	DLQURL      string
+	SQSEndpoint string
+	// EventPublisher selects where device lifecycle events go; EventsQueueURL
+	// is the outbound queue used by PublisherSQS (not the inbound SQSQueueURL)
+	EventPublisher string
+	EventsQueueURL string
+	// OutboxTable enables the transactional outbox: DynamoDB writes record
+	// their events there and the outbox relay publishes them. Entries are
+	// kept for OutboxRetention.
+	OutboxTable     string
+	OutboxRetention time.Duration
+	// HistoryTable holds the append-only change history of every device
+	HistoryTable string
+	// TombstoneRetention is how long a deleted device can be restored before
+	// TTL purges it
+	TombstoneRetention time.Duration
+	// HomesTable holds the homes devices are assigned to. HomeChecks makes
+	// device writes reject unknown homes and keep home device counts; stages
+	// with devices from before homes turn it off until cmd/backfill-homes has
+	// created the homes those devices use.
+	HomesTable string
+	HomeChecks bool
 }
 
 func Load() *Config {
 	return &Config{
-		DynamoDBTable: getEnv("DYNAMODB_TABLE", "devices"),
-		SQSQueueURL:   getEnv("SQS_QUEUE_URL", ""),
-		AWSRegion:     getEnv("AWS_REGION", "us-east-1"),
-		Stage:         getEnv("STAGE", "dev"),
-		DynamoDBURL:   os.Getenv("DYNAMODB_URL"),
+		DynamoDBTable:      getEnv("DYNAMODB_TABLE", "devices"),
+		MACTable:           getEnv("DYNAMODB_MAC_TABLE", "device-macs"),
+		SQSQueueURL:        getEnv("SQS_QUEUE_URL", ""),
+		AWSRegion:          getEnv("AWS_REGION", "us-east-1"),
+		Stage:              getEnv("STAGE", "dev"),
+		DynamoDBURL:        os.Getenv("DYNAMODB_URL"),
+		StorageBackend:     getEnv("STORAGE_BACKEND", StorageDynamoDB),
+		HTTPAddr:           getEnv("HTTP_ADDR", ":8080"),
+		APIPayloadFormat:   getEnv("API_PAYLOAD_FORMAT", "v1"),
+		DedupTable:         getEnv("DYNAMODB_DEDUP_TABLE", "processed-messages"),
+		DedupLease:         getDurationEnv("DEDUP_LEASE", time.Minute),
+		DedupRetention:     getDurationEnv("DEDUP_RETENTION", 24*time.Hour),
+		DLQURL:             getEnv("SQS_DLQ_URL", ""),
+		SQSEndpoint:        os.Getenv("SQS_ENDPOINT"),
+		EventPublisher:     getEnv("EVENT_PUBLISHER", PublisherNone),
+		EventsQueueURL:     getEnv("EVENTS_QUEUE_URL", ""),
+		OutboxTable:        getEnv("DYNAMODB_OUTBOX_TABLE", ""),
+		OutboxRetention:    getDurationEnv("OUTBOX_RETENTION", 7*24*time.Hour),
+		HistoryTable:       getEnv("DYNAMODB_HISTORY_TABLE", "device-history"),
+		TombstoneRetention: getDurationEnv("TOMBSTONE_RETENTION", 30*24*time.Hour),
+		HomesTable:         getEnv("DYNAMODB_HOMES_TABLE", "homes"),
+		HomeChecks:         getBoolEnv("HOME_CHECKS", true),
 	}
 }
 
@@ -28,3 +99,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDurationEnv parses key as a time.Duration ("90s", "24h"), falling back
+// to defaultValue when it is unset or invalid
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getBoolEnv parses key as a bool ("true", "1", "false"), falling back to
+// defaultValue when it is unset or invalid
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
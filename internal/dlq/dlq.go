@@ -0,0 +1,273 @@
+// Package dlq inspects the device notification dead-letter queue, replays its
+// messages and redrives them to the main queue.
+//
+// SQS has no way to read a message by ID, so every operation receives the
+// visible DLQ messages, hides them while it works and makes the ones it did
+// not consume visible again.
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// scanWaitTimeSeconds makes every receive a long poll. Short polls sample
+	// a subset of the SQS servers and can come back empty while messages
+	// remain.
+	scanWaitTimeSeconds = int32(20)
+	// scanEmptyReceives is the number of consecutive empty receives after
+	// which a scan assumes it has seen every visible message
+	scanEmptyReceives = 3
+	// scanVisibilityTimeout hides received messages long enough for one scan,
+	// including its trailing empty receives, to see each message only once
+	scanVisibilityTimeout = int32(300)
+)
+
+// SQSAPI is the subset of *sqs.Client used here; tests substitute a local
+// stand-in
+type SQSAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Message is a DLQ message with its body decoded as a models.SQSMessage when
+// possible
+type Message struct {
+	ID            string             `json:"id"`
+	ReceiptHandle string             `json:"-"`
+	ReceiveCount  int                `json:"receiveCount"`
+	SentAt        time.Time          `json:"sentAt"`
+	Body          string             `json:"body"`
+	Decoded       *models.SQSMessage `json:"decoded,omitempty"`
+	DecodeError   string             `json:"decodeError,omitempty"`
+}
+
+// ReplayResult is the outcome of replaying one message
+type ReplayResult struct {
+	ID  string `json:"id"`
+	Err error  `json:"-"`
+}
+
+// ProcessFunc applies a message body, normally SQSService.ProcessMessage
+type ProcessFunc func(ctx context.Context, body string) error
+
+type Client struct {
+	sqs      SQSAPI
+	dlqURL   string
+	queueURL string
+	logger   *zap.Logger
+}
+
+// NewClient operates on the dead-letter queue dlqURL and redrives to queueURL
+func NewClient(api SQSAPI, dlqURL string, queueURL string, logger *zap.Logger) *Client {
+	return &Client{
+		sqs:      api,
+		dlqURL:   dlqURL,
+		queueURL: queueURL,
+		logger:   logger,
+	}
+}
+
+// List returns up to max DLQ messages (all when max is 0) without consuming them
+func (c *Client) List(ctx context.Context, max int) ([]Message, error) {
+	messages, err := c.scan(ctx, max)
+	c.release(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Replay runs the messages with the given IDs through process and leaves them
+// in the DLQ. IDs that are not in the DLQ are reported as not found.
+func (c *Client) Replay(ctx context.Context, ids []string, process ProcessFunc) ([]ReplayResult, error) {
+	messages, err := c.scan(ctx, 0)
+	defer c.release(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := indexByID(messages)
+	results := make([]ReplayResult, 0, len(ids))
+	for _, id := range ids {
+		message, ok := byID[id]
+		if !ok {
+			results = append(results, ReplayResult{ID: id, Err: notFound("Replay", id)})
+			continue
+		}
+		results = append(results, ReplayResult{ID: id, Err: process(ctx, message.Body)})
+	}
+
+	return results, nil
+}
+
+// Redrive sends the messages with the given IDs, or every message when ids is
+// empty, back to the main queue and deletes them from the DLQ. It returns the
+// IDs that were moved.
+func (c *Client) Redrive(ctx context.Context, ids []string) ([]string, error) {
+	messages, err := c.scan(ctx, 0)
+	if err != nil {
+		c.release(ctx, messages)
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var redriven []string
+	var remaining []Message
+	for i, message := range messages {
+		if len(ids) > 0 && !wanted[message.ID] {
+			remaining = append(remaining, message)
+			continue
+		}
+
+		if err := c.move(ctx, message); err != nil {
+			c.release(ctx, append(remaining, messages[i:]...))
+			return redriven, err
+		}
+		redriven = append(redriven, message.ID)
+		delete(wanted, message.ID)
+	}
+	c.release(ctx, remaining)
+
+	for id := range wanted {
+		c.logger.Warn("message not found in DLQ", zap.String("message-id", id))
+	}
+
+	return redriven, nil
+}
+
+// move sends message to the main queue before deleting it from the DLQ, so a
+// failure in between duplicates the message rather than losing it
+func (c *Client) move(ctx context.Context, message Message) error {
+	if _, err := c.sqs.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(c.queueURL),
+		MessageBody: aws.String(message.Body),
+	}); err != nil {
+		return errors.WrapError(errors.ErrorTypeExternal, "failed to send message to queue", err).
+			WithOperation("Redrive").
+			WithContext("message_id", message.ID)
+	}
+
+	if _, err := c.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.dlqURL),
+		ReceiptHandle: aws.String(message.ReceiptHandle),
+	}); err != nil {
+		return errors.WrapError(errors.ErrorTypeExternal, "failed to delete redriven message from DLQ", err).
+			WithOperation("Redrive").
+			WithContext("message_id", message.ID)
+	}
+
+	c.logger.Info("message redriven", zap.String("message-id", message.ID))
+	return nil
+}
+
+// scan receives up to max visible DLQ messages (all when max is 0). Received
+// messages stay hidden until released.
+func (c *Client) scan(ctx context.Context, max int) ([]Message, error) {
+	var messages []Message
+	empty := 0
+	for max == 0 || len(messages) < max {
+		batch := int32(10)
+		if max > 0 && max-len(messages) < 10 {
+			batch = int32(max - len(messages))
+		}
+
+		out, err := c.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(c.dlqURL),
+			MaxNumberOfMessages: batch,
+			VisibilityTimeout:   scanVisibilityTimeout,
+			WaitTimeSeconds:     scanWaitTimeSeconds,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+				types.MessageSystemAttributeNameSentTimestamp,
+			},
+		})
+		if err != nil {
+			return messages, errors.WrapError(errors.ErrorTypeExternal, "failed to receive DLQ messages", err).
+				WithOperation("Scan").
+				WithContext("queue_url", c.dlqURL)
+		}
+		if len(out.Messages) == 0 {
+			empty++
+			if empty == scanEmptyReceives {
+				break
+			}
+			continue
+		}
+		empty = 0
+
+		for _, received := range out.Messages {
+			messages = append(messages, toMessage(received))
+		}
+	}
+
+	return messages, nil
+}
+
+// release makes messages visible again. Failures are only logged: the
+// messages reappear once the scan visibility timeout expires.
+func (c *Client) release(ctx context.Context, messages []Message) {
+	for _, message := range messages {
+		if _, err := c.sqs.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(c.dlqURL),
+			ReceiptHandle:     aws.String(message.ReceiptHandle),
+			VisibilityTimeout: 0,
+		}); err != nil {
+			c.logger.Warn("failed to release DLQ message", zap.String("message-id", message.ID), zap.Error(err))
+		}
+	}
+}
+
+func toMessage(received types.Message) Message {
+	message := Message{
+		ID:            aws.ToString(received.MessageId),
+		ReceiptHandle: aws.ToString(received.ReceiptHandle),
+		Body:          aws.ToString(received.Body),
+	}
+
+	if count, err := strconv.Atoi(received.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)]); err == nil {
+		message.ReceiveCount = count
+	}
+	if sent, err := strconv.ParseInt(received.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		message.SentAt = time.UnixMilli(sent).UTC()
+	}
+
+	var decoded models.SQSMessage
+	if err := json.Unmarshal([]byte(message.Body), &decoded); err != nil {
+		message.DecodeError = err.Error()
+	} else {
+		message.Decoded = &decoded
+	}
+
+	return message
+}
+
+func indexByID(messages []Message) map[string]Message {
+	byID := make(map[string]Message, len(messages))
+	for _, message := range messages {
+		byID[message.ID] = message
+	}
+	return byID
+}
+
+func notFound(operation string, id string) *errors.DomainError {
+	return errors.NewDomainError(errors.ErrorTypeNotFound, "message not found in DLQ").
+		WithOperation(operation).
+		WithContext("message_id", id)
+}
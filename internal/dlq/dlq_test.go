@@ -0,0 +1,237 @@
+package dlq
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	domainerrors "example.com/smart-devices/internal/errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+)
+
+const (
+	dlqURL   = "http://localhost:9324/queue/dlq"
+	queueURL = "http://localhost:9324/queue/main"
+)
+
+type fakeMessage struct {
+	id       string
+	body     string
+	receipt  string
+	hidden   bool
+	receives int
+}
+
+// fakeSQS is a local SQS stand-in: messages become hidden when received and
+// visible again when their visibility timeout is reset. Like a short poll
+// that misses the servers holding messages, every receive listed in misses
+// (counted from 1) comes back empty.
+type fakeSQS struct {
+	queues   map[string][]*fakeMessage
+	sequence int
+	receives int
+	misses   map[int]bool
+	waits    []int32
+}
+
+func newFakeSQS() *fakeSQS {
+	return &fakeSQS{queues: make(map[string][]*fakeMessage)}
+}
+
+func (f *fakeSQS) add(url string, id string, body string) {
+	f.queues[url] = append(f.queues[url], &fakeMessage{id: id, body: body, receives: 3})
+}
+
+func (f *fakeSQS) ReceiveMessage(_ context.Context, params *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{}
+	f.receives++
+	f.waits = append(f.waits, params.WaitTimeSeconds)
+	if f.misses[f.receives] {
+		return out, nil
+	}
+	for _, message := range f.queues[aws.ToString(params.QueueUrl)] {
+		if len(out.Messages) == int(params.MaxNumberOfMessages) {
+			break
+		}
+		if message.hidden {
+			continue
+		}
+
+		f.sequence++
+		message.hidden = true
+		message.receives++
+		message.receipt = fmt.Sprintf("receipt-%d", f.sequence)
+		out.Messages = append(out.Messages, types.Message{
+			MessageId:     aws.String(message.id),
+			ReceiptHandle: aws.String(message.receipt),
+			Body:          aws.String(message.body),
+			Attributes: map[string]string{
+				"ApproximateReceiveCount": strconv.Itoa(message.receives),
+				"SentTimestamp":           "1704067200000",
+			},
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.sequence++
+	id := fmt.Sprintf("sent-%d", f.sequence)
+	f.queues[aws.ToString(params.QueueUrl)] = append(f.queues[aws.ToString(params.QueueUrl)], &fakeMessage{id: id, body: aws.ToString(params.MessageBody)})
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(_ context.Context, params *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	url := aws.ToString(params.QueueUrl)
+	for i, message := range f.queues[url] {
+		if message.receipt == aws.ToString(params.ReceiptHandle) {
+			f.queues[url] = append(f.queues[url][:i], f.queues[url][i+1:]...)
+			return &sqs.DeleteMessageOutput{}, nil
+		}
+	}
+	return nil, stderrors.New("receipt handle is invalid")
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(_ context.Context, params *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	for _, message := range f.queues[aws.ToString(params.QueueUrl)] {
+		if message.receipt == aws.ToString(params.ReceiptHandle) {
+			message.hidden = params.VisibilityTimeout > 0
+			return &sqs.ChangeMessageVisibilityOutput{}, nil
+		}
+	}
+	return nil, stderrors.New("receipt handle is invalid")
+}
+
+func (f *fakeSQS) visible(url string) []string {
+	var ids []string
+	for _, message := range f.queues[url] {
+		if !message.hidden {
+			ids = append(ids, message.id)
+		}
+	}
+	return ids
+}
+
+func newTestClient(t *testing.T, count int) (*Client, *fakeSQS) {
+	t.Helper()
+
+	fake := newFakeSQS()
+	for i := 1; i <= count; i++ {
+		fake.add(dlqURL, fmt.Sprintf("m-%d", i), fmt.Sprintf(`{"action":"assign_home","deviceId":"device-%d","homeId":"home-1"}`, i))
+	}
+	return NewClient(fake, dlqURL, queueURL, zap.NewNop()), fake
+}
+
+func TestClient_List(t *testing.T) {
+	client, fake := newTestClient(t, 12)
+	fake.add(dlqURL, "garbage", "{")
+
+	messages, err := client.List(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 13 {
+		t.Fatalf("Expected 13 messages, got %d", len(messages))
+	}
+
+	first := messages[0]
+	if first.Decoded == nil || first.Decoded.DeviceID != "device-1" || first.ReceiveCount != 4 || first.SentAt.IsZero() {
+		t.Errorf("Expected decoded message with attributes, got %+v", first)
+	}
+	if last := messages[12]; last.Decoded != nil || last.DecodeError == "" {
+		t.Errorf("Expected decode error for malformed body, got %+v", last)
+	}
+
+	if visible := fake.visible(dlqURL); len(visible) != 13 {
+		t.Errorf("Expected listing to leave all 13 messages visible, got %d", len(visible))
+	}
+
+	limited, err := client.List(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(limited) != 5 {
+		t.Errorf("Expected 5 messages, got %d", len(limited))
+	}
+}
+
+func TestClient_List_EmptyReceives(t *testing.T) {
+	client, fake := newTestClient(t, 12)
+	// An empty receive before, between and after the two batches of 10
+	fake.misses = map[int]bool{1: true, 3: true, 4: true}
+
+	messages, err := client.List(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 12 {
+		t.Errorf("Expected all 12 messages despite empty receives, got %d", len(messages))
+	}
+
+	for i, wait := range fake.waits {
+		if wait != scanWaitTimeSeconds {
+			t.Errorf("Expected receive %d to long poll for %d seconds, got %d", i+1, scanWaitTimeSeconds, wait)
+		}
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	client, fake := newTestClient(t, 3)
+
+	var processed []string
+	process := func(_ context.Context, body string) error {
+		processed = append(processed, body)
+		return domainerrors.ErrDomainDeviceNotFound
+	}
+
+	results, err := client.Replay(context.Background(), []string{"m-2", "missing"}, process)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(processed) != 1 || processed[0] != `{"action":"assign_home","deviceId":"device-2","homeId":"home-1"}` {
+		t.Errorf("Expected only m-2 to be processed, got %v", processed)
+	}
+	if len(results) != 2 || !stderrors.Is(results[0].Err, domainerrors.ErrDomainDeviceNotFound) {
+		t.Fatalf("Expected m-2 to report the processing error, got %+v", results)
+	}
+	if !stderrors.Is(results[1].Err, domainerrors.NewDomainError(domainerrors.ErrorTypeNotFound, "")) {
+		t.Errorf("Expected missing message to be reported as not found, got %v", results[1].Err)
+	}
+
+	if visible := fake.visible(dlqURL); len(visible) != 3 {
+		t.Errorf("Expected replay to leave all messages in the DLQ, got %v", visible)
+	}
+}
+
+func TestClient_Redrive(t *testing.T) {
+	client, fake := newTestClient(t, 3)
+
+	redriven, err := client.Redrive(context.Background(), []string{"m-1", "m-3"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(redriven) != 2 {
+		t.Errorf("Expected 2 redriven messages, got %v", redriven)
+	}
+
+	if visible := fake.visible(dlqURL); len(visible) != 1 || visible[0] != "m-2" {
+		t.Errorf("Expected only m-2 to remain in the DLQ, got %v", visible)
+	}
+	if moved := fake.queues[queueURL]; len(moved) != 2 || moved[0].body != `{"action":"assign_home","deviceId":"device-1","homeId":"home-1"}` {
+		t.Errorf("Expected bodies of m-1 and m-3 on the main queue, got %d messages", len(moved))
+	}
+
+	redriven, err = client.Redrive(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(redriven) != 1 || len(fake.queues[dlqURL]) != 0 || len(fake.queues[queueURL]) != 3 {
+		t.Errorf("Expected redrive of everything to empty the DLQ, got %v", redriven)
+	}
+}
@@ -51,6 +51,12 @@ var (
 		StatusCode: 400,
 	}
 
+	ErrMissingHomeID = APIError{
+		Code:       "MISSING_HOME_ID",
+		Message:    "Home ID is required",
+		StatusCode: 400,
+	}
+
 	ErrMissingRequestBody = APIError{
 		Code:       "MISSING_REQUEST_BODY",
 		Message:    "Request body is required",
@@ -69,6 +75,12 @@ var (
 		StatusCode: 400,
 	}
 
+	ErrInvalidIfMatch = APIError{
+		Code:       "INVALID_IF_MATCH",
+		Message:    "If-Match header must be a device ETag",
+		StatusCode: 400,
+	}
+
 	// 404 Not Found errors
 	ErrDeviceNotFound = APIError{
 		Code:       "DEVICE_NOT_FOUND",
@@ -82,6 +94,19 @@ var (
 		StatusCode: 404,
 	}
 
+	ErrRouteNotFound = APIError{
+		Code:       "ROUTE_NOT_FOUND",
+		Message:    "No route matches the request path",
+		StatusCode: 404,
+	}
+
+	// 405 Method Not Allowed errors
+	ErrMethodNotAllowed = APIError{
+		Code:       "METHOD_NOT_ALLOWED",
+		Message:    "Method is not allowed for this resource",
+		StatusCode: 405,
+	}
+
 	// 500 Internal Server errors
 	ErrInternalServer = APIError{
 		Code:       "INTERNAL_SERVER_ERROR",
@@ -106,6 +131,30 @@ var (
 		Message:    "Failed to delete device",
 		StatusCode: 500,
 	}
+
+	ErrDeviceRestoreFailed = APIError{
+		Code:       "DEVICE_RESTORE_FAILED",
+		Message:    "Failed to restore device",
+		StatusCode: 500,
+	}
+
+	ErrHomeCreationFailed = APIError{
+		Code:       "HOME_CREATION_FAILED",
+		Message:    "Failed to create home",
+		StatusCode: 500,
+	}
+
+	ErrHomeUpdateFailed = APIError{
+		Code:       "HOME_UPDATE_FAILED",
+		Message:    "Failed to update home",
+		StatusCode: 500,
+	}
+
+	ErrHomeDeletionFailed = APIError{
+		Code:       "HOME_DELETION_FAILED",
+		Message:    "Failed to delete home",
+		StatusCode: 500,
+	}
 )
 
 // WithMessage creates a new APIError with a custom message
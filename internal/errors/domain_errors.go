@@ -2,7 +2,9 @@ package errors
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"maps"
 )
 
 // ErrorType represents different categories of errors
@@ -12,6 +14,7 @@ const (
 	ErrorTypeValidation   ErrorType = "validation"
 	ErrorTypeNotFound     ErrorType = "not_found"
 	ErrorTypeConflict     ErrorType = "conflict"
+	ErrorTypePrecondition ErrorType = "precondition_failed"
 	ErrorTypeDatabase     ErrorType = "database"
 	ErrorTypeExternal     ErrorType = "external"
 	ErrorTypeInternal     ErrorType = "internal"
@@ -42,25 +45,37 @@ func (e *DomainError) Unwrap() error {
 	return e.Cause
 }
 
-// WithContext adds context information to the error
+// WithContext returns a copy of the error with the context key set. The
+// predefined errors are shared across goroutines, so the With* methods never
+// modify the receiver.
 func (e *DomainError) WithContext(key string, value interface{}) *DomainError {
-	if e.Context == nil {
-		e.Context = make(map[string]interface{})
-	}
-	e.Context[key] = value
-	return e
+	c := e.clone()
+	c.Context[key] = value
+	return c
 }
 
-// WithOperation sets the operation that caused the error
+// WithOperation returns a copy of the error with the operation that caused it
 func (e *DomainError) WithOperation(operation string) *DomainError {
-	e.Operation = operation
-	return e
+	c := e.clone()
+	c.Operation = operation
+	return c
 }
 
-// WithLayer sets the layer where the error occurred
+// WithLayer returns a copy of the error with the layer where it occurred
 func (e *DomainError) WithLayer(layer string) *DomainError {
-	e.Layer = layer
-	return e
+	c := e.clone()
+	c.Layer = layer
+	return c
+}
+
+// clone copies the error, including its context map
+func (e *DomainError) clone() *DomainError {
+	c := *e
+	c.Context = maps.Clone(e.Context)
+	if c.Context == nil {
+		c.Context = make(map[string]interface{})
+	}
+	return &c
 }
 
 // Is implements error comparison for errors.Is()
@@ -71,6 +86,24 @@ func (e *DomainError) Is(target error) bool {
 	return false
 }
 
+// IsPermanent reports whether retrying the operation that failed with err
+// cannot succeed. Validation, not found, conflict, precondition and
+// authorization errors are permanent; database, external and internal errors,
+// as well as errors that are not DomainErrors, are treated as transient.
+func IsPermanent(err error) bool {
+	var domainErr *DomainError
+	if !stderrors.As(err, &domainErr) {
+		return false
+	}
+
+	switch domainErr.Type {
+	case ErrorTypeValidation, ErrorTypeNotFound, ErrorTypeConflict, ErrorTypePrecondition, ErrorTypeUnauthorized:
+		return true
+	default:
+		return false
+	}
+}
+
 // NewDomainError creates a new DomainError
 func NewDomainError(errorType ErrorType, message string) *DomainError {
 	var statusCode int
@@ -81,6 +114,8 @@ func NewDomainError(errorType ErrorType, message string) *DomainError {
 		statusCode = 404
 	case ErrorTypeConflict:
 		statusCode = 409
+	case ErrorTypePrecondition:
+		statusCode = 412
 	case ErrorTypeUnauthorized:
 		statusCode = 401
 	case ErrorTypeDatabase, ErrorTypeExternal, ErrorTypeInternal:
@@ -115,13 +150,22 @@ var (
 	ErrDomainInvalidType     = NewDomainError(ErrorTypeValidation, "device type must be one of: thermostat, light, camera, sensor")
 	ErrDomainInvalidHomeID   = NewDomainError(ErrorTypeValidation, "home ID must be a valid UUID")
 	ErrDomainMissingHomeID   = NewDomainError(ErrorTypeValidation, "home ID is required")
+	ErrDomainUnknownAction   = NewDomainError(ErrorTypeValidation, "unknown message action")
+	ErrDomainUnknownHome     = NewDomainError(ErrorTypeValidation, "home does not exist")
 
 	// Not found errors
 	ErrDomainDeviceNotFound = NewDomainError(ErrorTypeNotFound, "device not found")
 	ErrDomainNoDevicesFound = NewDomainError(ErrorTypeNotFound, "no devices found")
+	ErrDomainHomeNotFound   = NewDomainError(ErrorTypeNotFound, "home not found")
 
 	// Conflict errors
-	ErrDomainDeviceExists = NewDomainError(ErrorTypeConflict, "device already exists")
+	ErrDomainDeviceExists     = NewDomainError(ErrorTypeConflict, "device already exists")
+	ErrDomainDeviceNotDeleted = NewDomainError(ErrorTypeConflict, "device is not deleted")
+	ErrDomainHomeNotEmpty     = NewDomainError(ErrorTypeConflict, "home still has devices")
+
+	// Precondition errors
+	ErrDomainVersionMismatch     = NewDomainError(ErrorTypePrecondition, "device has been modified since it was last read")
+	ErrDomainHomeVersionMismatch = NewDomainError(ErrorTypePrecondition, "home has been modified since it was last read")
 
 	// Database errors
 	ErrDatabaseOperation = NewDomainError(ErrorTypeDatabase, "database operation failed")
@@ -130,6 +174,7 @@ var (
 
 	// Internal errors
 	ErrInternalOperation = NewDomainError(ErrorTypeInternal, "internal operation failed")
+	ErrMessageInFlight   = NewDomainError(ErrorTypeInternal, "message is being processed by another delivery")
 )
 
 // FromContext extracts error context from context.Context if available
@@ -169,6 +214,8 @@ func (e *DomainError) ToAPIError() APIError {
 		code = "NOT_FOUND"
 	case ErrorTypeConflict:
 		code = "CONFLICT"
+	case ErrorTypePrecondition:
+		code = "PRECONDITION_FAILED"
 	case ErrorTypeUnauthorized:
 		code = "UNAUTHORIZED"
 	default:
@@ -0,0 +1,55 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDomainError_WithDoesNotModifySentinel(t *testing.T) {
+	err := ErrDomainDeviceNotFound.
+		WithOperation("GetDevice").
+		WithLayer("repository").
+		WithContext("device_id", "device-1")
+
+	if err == ErrDomainDeviceNotFound {
+		t.Fatal("Expected a copy of the predefined error")
+	}
+	if err.Operation != "GetDevice" || err.Layer != "repository" || err.Context["device_id"] != "device-1" {
+		t.Errorf("Expected the copy to carry operation, layer and context, got %+v", err)
+	}
+	if ErrDomainDeviceNotFound.Operation != "" || ErrDomainDeviceNotFound.Layer != "" || len(ErrDomainDeviceNotFound.Context) != 0 {
+		t.Errorf("Expected the predefined error to stay unchanged, got %+v", ErrDomainDeviceNotFound)
+	}
+	if !stderrors.Is(err, ErrDomainDeviceNotFound) {
+		t.Error("Expected the copy to match the predefined error")
+	}
+
+	// Copies do not share context with each other
+	other := err.WithContext("device_id", "device-2")
+	if err.Context["device_id"] != "device-1" {
+		t.Errorf("Expected device-1 on the first copy, got %v", err.Context["device_id"])
+	}
+	if other.Context["device_id"] != "device-2" {
+		t.Errorf("Expected device-2 on the second copy, got %v", other.Context["device_id"])
+	}
+}
+
+// TestDomainError_WithConcurrent decorates the same predefined error from
+// many goroutines, as concurrent requests do. Run with -race.
+func TestDomainError_WithConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("device-%d", i)
+			err := ErrDomainDeviceNotFound.WithOperation("GetDevice").WithLayer("service").WithContext("device_id", id)
+			if err.Context["device_id"] != id {
+				t.Errorf("Expected %s, got %v", id, err.Context["device_id"])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"context"
+	"example.com/smart-devices/internal/audit"
 	"example.com/smart-devices/internal/errors"
 	"example.com/smart-devices/internal/models"
 	"example.com/smart-devices/internal/services"
 	"example.com/smart-devices/internal/validation"
 	"example.com/smart-devices/utils"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"go.uber.org/zap"
 )
@@ -60,11 +62,21 @@ func (h *DeviceHandler) GetDevice(ctx context.Context, request events.APIGateway
 		return errors.ErrInternalServer.ToResponse(), nil
 	}
 
-	return utils.JSONSuccessResponse(200, device), nil
+	return utils.WithETag(utils.JSONSuccessResponse(200, device), device.Version), nil
 }
 
-func (h *DeviceHandler) GetDevices(ctx context.Context, _ events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	devices, err := h.svc.GetDevices(ctx)
+func (h *DeviceHandler) GetDevices(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	limit, nextToken, err := validation.ValidatePagination(request.QueryStringParameters)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("fetching devices",
+		zap.Int32("limit", limit),
+		zap.String("layer", "handler"),
+	)
+
+	page, err := h.svc.GetDevices(ctx, limit, nextToken)
 	if err != nil {
 		// Check if it's a domain error and convert appropriately
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -83,9 +95,95 @@ func (h *DeviceHandler) GetDevices(ctx context.Context, _ events.APIGatewayProxy
 		return errors.ErrInternalServer.ToResponse(), nil
 	}
 
+	return utils.JSONSuccessResponse(200, page), nil
+}
+
+func (h *DeviceHandler) GetDevicesByHome(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	homeID, ok := request.PathParameters["homeId"]
+	if !ok || homeID == "" {
+		return errors.ErrMissingHomeID.ToResponse(), nil
+	}
+
+	// Validate home ID format
+	if err := validation.ValidateHomeID(homeID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("fetching devices by home",
+		zap.String("home_id", homeID),
+		zap.String("layer", "handler"),
+	)
+
+	devices, err := h.svc.GetDevicesByHome(ctx, homeID)
+	if err != nil {
+		// Check if it's a domain error and convert appropriately
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			h.logger.Warn("devices by home retrieval failed",
+				zap.String("home_id", homeID),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.String("operation", domainErr.Operation),
+				zap.Error(err),
+			)
+			return domainErr.ToAPIError().ToResponse(), nil
+		}
+
+		// Fallback for unknown errors
+		h.logger.Error("unexpected error during devices by home retrieval",
+			zap.String("home_id", homeID),
+			zap.Error(err),
+		)
+		return errors.ErrInternalServer.ToResponse(), nil
+	}
+
 	return utils.JSONSuccessResponse(200, devices), nil
 }
 
+func (h *DeviceHandler) GetDeviceHistory(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	deviceID, ok := request.PathParameters["id"]
+	if !ok || deviceID == "" {
+		return errors.ErrMissingDeviceID.ToResponse(), nil
+	}
+
+	// Validate device ID format
+	if err := validation.ValidateDeviceID(deviceID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	limit, nextToken, err := validation.ValidatePagination(request.QueryStringParameters)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("fetching device history",
+		zap.String("device_id", deviceID),
+		zap.Int32("limit", limit),
+		zap.String("layer", "handler"),
+	)
+
+	page, err := h.svc.GetDeviceHistory(ctx, deviceID, limit, nextToken)
+	if err != nil {
+		// Check if it's a domain error and convert appropriately
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			h.logger.Warn("device history retrieval failed",
+				zap.String("device_id", deviceID),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.String("operation", domainErr.Operation),
+				zap.Error(err),
+			)
+			return domainErr.ToAPIError().ToResponse(), nil
+		}
+
+		// Fallback for unknown errors
+		h.logger.Error("unexpected error during device history retrieval",
+			zap.String("device_id", deviceID),
+			zap.Error(err),
+		)
+		return errors.ErrInternalServer.ToResponse(), nil
+	}
+
+	return utils.JSONSuccessResponse(200, page), nil
+}
+
 func (h *DeviceHandler) DeleteDevice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	deviceID, ok := request.PathParameters["id"]
 	if !ok || deviceID == "" {
@@ -97,12 +195,17 @@ func (h *DeviceHandler) DeleteDevice(ctx context.Context, request events.APIGate
 		return err.(errors.APIError).ToResponse(), nil
 	}
 
+	expectedVersion, err := validation.ValidateIfMatch(request.Headers)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
 	h.logger.Debug("deleting device",
 		zap.String("device_id", deviceID),
 		zap.String("layer", "handler"),
 	)
 
-	err := h.svc.DeleteDevice(ctx, deviceID)
+	deletedDevice, err := h.svc.DeleteDevice(withHTTPActor(ctx, request), deviceID, expectedVersion)
 	if err != nil {
 		// Check if it's a domain error and convert appropriately
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -123,7 +226,52 @@ func (h *DeviceHandler) DeleteDevice(ctx context.Context, request events.APIGate
 		return errors.ErrDeviceDeletionFailed.ToResponse(), nil
 	}
 
-	return utils.JSONSuccessResponse(200, map[string]string{"message": "Device deleted successfully"}), nil
+	return utils.JSONSuccessResponse(200, models.DeleteDeviceResponse{
+		Message: "Device deleted successfully",
+		Device:  deletedDevice,
+	}), nil
+}
+
+// RestoreDevice undoes the soft delete of a device whose tombstone has not
+// been purged yet
+func (h *DeviceHandler) RestoreDevice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	deviceID, ok := request.PathParameters["id"]
+	if !ok || deviceID == "" {
+		return errors.ErrMissingDeviceID.ToResponse(), nil
+	}
+
+	// Validate device ID format
+	if err := validation.ValidateDeviceID(deviceID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("restoring device",
+		zap.String("device_id", deviceID),
+		zap.String("layer", "handler"),
+	)
+
+	restoredDevice, err := h.svc.RestoreDevice(withHTTPActor(ctx, request), deviceID)
+	if err != nil {
+		// Check if it's a domain error and convert appropriately
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			h.logger.Warn("device restore failed",
+				zap.String("device_id", deviceID),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.String("operation", domainErr.Operation),
+				zap.Error(err),
+			)
+			return domainErr.ToAPIError().ToResponse(), nil
+		}
+
+		// Fallback for unknown errors
+		h.logger.Error("unexpected error during device restore",
+			zap.String("device_id", deviceID),
+			zap.Error(err),
+		)
+		return errors.ErrDeviceRestoreFailed.ToResponse(), nil
+	}
+
+	return utils.WithETag(utils.JSONSuccessResponse(200, restoredDevice), restoredDevice.Version), nil
 }
 
 func (h *DeviceHandler) UpdateDevice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -137,6 +285,11 @@ func (h *DeviceHandler) UpdateDevice(ctx context.Context, request events.APIGate
 		return err.(errors.APIError).ToResponse(), nil
 	}
 
+	expectedVersion, err := validation.ValidateIfMatch(request.Headers)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
 	// Validate and parse request body
 	var updateReq models.UpdateDeviceRequest
 	if err := validation.ValidateJSON(request.Body, &updateReq); err != nil {
@@ -165,7 +318,7 @@ func (h *DeviceHandler) UpdateDevice(ctx context.Context, request events.APIGate
 		zap.String("layer", "handler"),
 	)
 
-	updatedDevice, err := h.svc.UpdateDevice(ctx, deviceID, device)
+	updatedDevice, err := h.svc.UpdateDevice(withHTTPActor(ctx, request), deviceID, device, expectedVersion)
 	if err != nil {
 		// Check if it's a domain error and convert appropriately
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -186,7 +339,7 @@ func (h *DeviceHandler) UpdateDevice(ctx context.Context, request events.APIGate
 		return errors.ErrDeviceUpdateFailed.ToResponse(), nil
 	}
 
-	return utils.JSONSuccessResponse(200, updatedDevice), nil
+	return utils.WithETag(utils.JSONSuccessResponse(200, updatedDevice), updatedDevice.Version), nil
 }
 
 func (h *DeviceHandler) CreateDevice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -216,7 +369,7 @@ func (h *DeviceHandler) CreateDevice(ctx context.Context, request events.APIGate
 		zap.String("layer", "handler"),
 	)
 
-	createdDevice, err := h.svc.CreateDevice(ctx, device)
+	createdDevice, err := h.svc.CreateDevice(withHTTPActor(ctx, request), device)
 	if err != nil {
 		// Check if it's a domain error and convert appropriately
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -237,5 +390,21 @@ func (h *DeviceHandler) CreateDevice(ctx context.Context, request events.APIGate
 		return errors.ErrDeviceCreationFailed.ToResponse(), nil
 	}
 
-	return utils.JSONSuccessResponse(201, createdDevice), nil
+	return utils.WithETag(utils.JSONSuccessResponse(201, createdDevice), createdDevice.Version), nil
+}
+
+// withHTTPActor records the caller of an HTTP request for the device history:
+// the authorizer's principal or token subject, else the IAM caller, else
+// "anonymous" when the API has no authorization
+func withHTTPActor(ctx context.Context, request events.APIGatewayProxyRequest) context.Context {
+	actor := "anonymous"
+	if principal, ok := request.RequestContext.Authorizer["principalId"].(string); ok && principal != "" {
+		actor = principal
+	} else if claims, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{}); ok && claims["sub"] != nil {
+		actor = fmt.Sprint(claims["sub"])
+	} else if request.RequestContext.Identity.UserArn != "" {
+		actor = request.RequestContext.Identity.UserArn
+	}
+
+	return audit.WithActor(ctx, audit.Actor{ID: actor, Source: models.SourceHTTP})
 }
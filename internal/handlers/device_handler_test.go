@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"example.com/smart-devices/internal/repository/memory"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/pkg/testsupport"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+func TestDeviceHandler_GetDevices_Pagination(t *testing.T) {
+	logger := zap.NewNop()
+	repo := memory.NewDeviceRepository(testsupport.NewFakeClock(testsupport.DefaultTime), testsupport.NewSequentialIDGenerator(), logger)
+	handler := NewDeviceHandler(services.NewDeviceService(repo, logger), logger)
+
+	tests := []struct {
+		name       string
+		params     map[string]string
+		wantStatus int
+	}{
+		{name: "non-numeric limit", params: map[string]string{"limit": "abc"}, wantStatus: 400},
+		{name: "limit out of bounds", params: map[string]string{"limit": "1000"}, wantStatus: 400},
+		{name: "malformed token", params: map[string]string{"nextToken": "!!!"}, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := handler.GetDevices(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: tt.params})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, response.StatusCode, response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/internal/validation"
+	"example.com/smart-devices/utils"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+type HomeHandler struct {
+	svc    *services.HomeService
+	logger *zap.Logger
+}
+
+func NewHomeHandler(svc *services.HomeService, logger *zap.Logger) *HomeHandler {
+	return &HomeHandler{
+		svc:    svc,
+		logger: logger,
+	}
+}
+
+// Routes returns every HTTP route served by the home handler. The home ID
+// is named homeId to match /homes/{homeId}/devices, as API Gateway requires
+// sibling path variables to share a name.
+func (h *HomeHandler) Routes() []Route {
+	return []Route{
+		{Method: "GET", Resource: "/homes", Handler: h.GetHomes},
+		{Method: "POST", Resource: "/homes", Handler: h.CreateHome},
+		{Method: "GET", Resource: "/homes/{homeId}", Handler: h.GetHome},
+		{Method: "PUT", Resource: "/homes/{homeId}", Handler: h.UpdateHome},
+		{Method: "DELETE", Resource: "/homes/{homeId}", Handler: h.DeleteHome},
+	}
+}
+
+func (h *HomeHandler) GetHome(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	homeID, ok := request.PathParameters["homeId"]
+	if !ok || homeID == "" {
+		return errors.ErrMissingHomeID.ToResponse(), nil
+	}
+
+	// Validate home ID format
+	if err := validation.ValidateHomeID(homeID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("fetching home",
+		zap.String("home_id", homeID),
+		zap.String("layer", "handler"),
+	)
+
+	home, err := h.svc.GetHome(ctx, homeID)
+	if err != nil {
+		return h.errorResponse(err, "home retrieval", homeID, errors.ErrInternalServer), nil
+	}
+
+	return utils.WithETag(utils.JSONSuccessResponse(200, home), home.Version), nil
+}
+
+func (h *HomeHandler) GetHomes(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	limit, nextToken, err := validation.ValidatePagination(request.QueryStringParameters)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("fetching homes",
+		zap.Int32("limit", limit),
+		zap.String("layer", "handler"),
+	)
+
+	page, err := h.svc.GetHomes(ctx, limit, nextToken)
+	if err != nil {
+		return h.errorResponse(err, "homes retrieval", "", errors.ErrInternalServer), nil
+	}
+
+	return utils.JSONSuccessResponse(200, page), nil
+}
+
+func (h *HomeHandler) CreateHome(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Validate and parse request body
+	var createReq models.CreateHomeRequest
+	if err := validation.ValidateJSON(request.Body, &createReq); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	// Validate request data
+	if err := validation.ValidateCreateHomeRequest(createReq); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	home := models.Home{
+		Name:     createReq.Name,
+		Address:  createReq.Address,
+		Timezone: createReq.Timezone,
+		Owner:    createReq.Owner,
+	}
+
+	h.logger.Debug("creating home",
+		zap.String("name", home.Name),
+		zap.String("layer", "handler"),
+	)
+
+	createdHome, err := h.svc.CreateHome(withHTTPActor(ctx, request), home)
+	if err != nil {
+		return h.errorResponse(err, "home creation", "", errors.ErrHomeCreationFailed), nil
+	}
+
+	return utils.WithETag(utils.JSONSuccessResponse(201, createdHome), createdHome.Version), nil
+}
+
+func (h *HomeHandler) UpdateHome(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	homeID, ok := request.PathParameters["homeId"]
+	if !ok || homeID == "" {
+		return errors.ErrMissingHomeID.ToResponse(), nil
+	}
+
+	// Validate home ID format
+	if err := validation.ValidateHomeID(homeID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	expectedVersion, err := validation.ValidateIfMatch(request.Headers)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	// Validate and parse request body
+	var updateReq models.UpdateHomeRequest
+	if err := validation.ValidateJSON(request.Body, &updateReq); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	// Validate request data
+	if err := validation.ValidateUpdateHomeRequest(updateReq); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("updating home",
+		zap.String("home_id", homeID),
+		zap.String("layer", "handler"),
+	)
+
+	updatedHome, err := h.svc.UpdateHome(withHTTPActor(ctx, request), homeID, updateReq, expectedVersion)
+	if err != nil {
+		return h.errorResponse(err, "home update", homeID, errors.ErrHomeUpdateFailed), nil
+	}
+
+	return utils.WithETag(utils.JSONSuccessResponse(200, updatedHome), updatedHome.Version), nil
+}
+
+// DeleteHome removes a home that no longer has devices assigned to it
+func (h *HomeHandler) DeleteHome(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	homeID, ok := request.PathParameters["homeId"]
+	if !ok || homeID == "" {
+		return errors.ErrMissingHomeID.ToResponse(), nil
+	}
+
+	// Validate home ID format
+	if err := validation.ValidateHomeID(homeID); err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	expectedVersion, err := validation.ValidateIfMatch(request.Headers)
+	if err != nil {
+		return err.(errors.APIError).ToResponse(), nil
+	}
+
+	h.logger.Debug("deleting home",
+		zap.String("home_id", homeID),
+		zap.String("layer", "handler"),
+	)
+
+	if err := h.svc.DeleteHome(withHTTPActor(ctx, request), homeID, expectedVersion); err != nil {
+		return h.errorResponse(err, "home deletion", homeID, errors.ErrHomeDeletionFailed), nil
+	}
+
+	return utils.JSONSuccessResponse(200, map[string]string{"message": "Home deleted successfully"}), nil
+}
+
+// errorResponse converts a service error to its API response, falling back to
+// fallback for errors that are not domain errors
+func (h *HomeHandler) errorResponse(err error, action string, homeID string, fallback errors.APIError) events.APIGatewayProxyResponse {
+	if domainErr, ok := err.(*errors.DomainError); ok {
+		h.logger.Warn(action+" failed",
+			zap.String("home_id", homeID),
+			zap.String("error_type", string(domainErr.Type)),
+			zap.String("operation", domainErr.Operation),
+			zap.Error(err),
+		)
+		return domainErr.ToAPIError().ToResponse()
+	}
+
+	h.logger.Error("unexpected error during "+action,
+		zap.String("home_id", homeID),
+		zap.Error(err),
+	)
+	return fallback.ToResponse()
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// APIHandlerFunc is the signature shared by all API Gateway handlers
+type APIHandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Route binds an HTTP method and API Gateway resource path (as declared in
+// serverless.yml, e.g. "/devices/{id}") to a handler
+type Route struct {
+	Method   string
+	Resource string
+	Handler  APIHandlerFunc
+}
+
+// Routes returns every HTTP route served by the device handler
+func (h *DeviceHandler) Routes() []Route {
+	return []Route{
+		{Method: "GET", Resource: "/devices", Handler: h.GetDevices},
+		{Method: "POST", Resource: "/devices", Handler: h.CreateDevice},
+		{Method: "GET", Resource: "/devices/{id}", Handler: h.GetDevice},
+		{Method: "PUT", Resource: "/devices/{id}", Handler: h.UpdateDevice},
+		{Method: "DELETE", Resource: "/devices/{id}", Handler: h.DeleteDevice},
+		{Method: "POST", Resource: "/devices/{id}/restore", Handler: h.RestoreDevice},
+		{Method: "GET", Resource: "/devices/{id}/history", Handler: h.GetDeviceHistory},
+		{Method: "GET", Resource: "/homes/{homeId}/devices", Handler: h.GetDevicesByHome},
+	}
+}
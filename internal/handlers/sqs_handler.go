@@ -19,12 +19,28 @@ func NewSQSHandler(sqsService *services.SQSService, logger *zap.Logger) *SQSHand
 	}
 }
 
-func (h *SQSHandler) ProcessMessage(ctx context.Context, sqsEvent events.SQSEvent) error {
+// ProcessMessage processes every record in the batch and reports the ones
+// that failed transiently, so SQS only redelivers those (requires
+// ReportBatchItemFailures on the event source mapping). Permanent failures
+// are dropped by the service.
+func (h *SQSHandler) ProcessMessage(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	var response events.SQSEventResponse
+
 	for _, record := range sqsEvent.Records {
-		if err := h.svc.ProcessMessage(ctx, record.Body); err != nil {
-			h.logger.Error("Error processing message", zap.Error(err))
-			return err
+		if err := h.svc.HandleRecord(ctx, record.MessageId, record.Body); err != nil {
+			h.logger.Error("Error processing message", zap.String("message-id", record.MessageId), zap.Error(err))
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: record.MessageId,
+			})
 		}
 	}
-	return nil
+
+	if len(response.BatchItemFailures) > 0 {
+		h.logger.Warn("batch processed with failures",
+			zap.Int("records", len(sqsEvent.Records)),
+			zap.Int("failures", len(response.BatchItemFailures)),
+		)
+	}
+
+	return response, nil
 }
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	domainerrors "example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/repository/memory"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/internal/validation"
+	"example.com/smart-devices/pkg/testsupport"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+func TestSQSHandler_ProcessMessage_ReportsOnlyTransientFailures(t *testing.T) {
+	logger := zap.NewNop()
+	repo := memory.NewDeviceRepository(testsupport.NewFakeClock(testsupport.DefaultTime), testsupport.NewSequentialIDGenerator(), logger)
+	deviceService := services.NewDeviceService(repo, logger)
+	sqsService := services.NewSQSService(deviceService, nil, logger)
+	sqsService.RegisterAction(models.ActionDelete, func(context.Context, models.SQSMessage) error {
+		return domainerrors.NewDomainError(domainerrors.ErrorTypeDatabase, "throttled")
+	}, validation.ValidateDeviceMessage)
+	handler := NewSQSHandler(sqsService, logger)
+
+	ctx := context.Background()
+	device, err := deviceService.CreateDevice(ctx, models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "sensor",
+		HomeID: "11111111-1111-4111-8111-111111111111",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	newHome := "22222222-2222-4222-8222-222222222222"
+	response, err := handler.ProcessMessage(ctx, events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "bad-json", Body: "{"},
+		{MessageId: "transient", Body: `{"action":"delete","deviceId":"` + device.ID + `"}`},
+		{MessageId: "ok", Body: `{"action":"assign_home","deviceId":"` + device.ID + `","homeId":"` + newHome + `"}`},
+		{MessageId: "unknown-action", Body: `{"action":"explode","deviceId":"` + device.ID + `"}`},
+		{MessageId: "missing-device", Body: `{"action":"rename","deviceId":"33333333-3333-4333-8333-333333333333","name":"x"}`},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var failed []string
+	for _, failure := range response.BatchItemFailures {
+		failed = append(failed, failure.ItemIdentifier)
+	}
+	// Malformed, unknown-action and missing-device messages are permanent
+	// failures and must not be redelivered
+	if len(failed) != 1 || failed[0] != "transient" {
+		t.Errorf("Expected failures [transient], got %v", failed)
+	}
+
+	stored, err := repo.GetDevice(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.HomeID != newHome {
+		t.Errorf("Expected records after a failure to be processed, home ID is %s", stored.HomeID)
+	}
+}
+
+func TestSQSHandler_ProcessMessage_SkipsRedeliveries(t *testing.T) {
+	logger := zap.NewNop()
+	clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+	repo := memory.NewDeviceRepository(clock, testsupport.NewSequentialIDGenerator(), logger)
+	deviceService := services.NewDeviceService(repo, logger)
+	dedup := memory.NewDedupStore(clock, time.Minute, time.Hour)
+	handler := NewSQSHandler(services.NewSQSService(deviceService, dedup, logger), logger)
+
+	ctx := context.Background()
+	device, err := deviceService.CreateDevice(ctx, models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "sensor",
+		HomeID: "11111111-1111-4111-8111-111111111111",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	body := `{"action":"assign_home","deviceId":"` + device.ID + `","homeId":"22222222-2222-4222-8222-222222222222"}`
+	deliver := func(messageID string, body string) {
+		t.Helper()
+		response, err := handler.ProcessMessage(ctx, events.SQSEvent{Records: []events.SQSMessage{{MessageId: messageID, Body: body}}})
+		if err != nil || len(response.BatchItemFailures) != 0 {
+			t.Fatalf("Expected message %s to succeed, got %v %v", messageID, response.BatchItemFailures, err)
+		}
+	}
+	version := func() int64 {
+		t.Helper()
+		stored, err := repo.GetDevice(ctx, device.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return stored.Version
+	}
+
+	deliver("m-1", body)
+	deliver("m-1", body)
+	if got := version(); got != device.Version+1 {
+		t.Errorf("Expected SQS redelivery to be applied once (version %d), got version %d", device.Version+1, got)
+	}
+
+	// A producer retry has a new SQS message ID but the same messageId
+	withKey := `{"messageId":"p-1","action":"rename","deviceId":"` + device.ID + `","name":"Kitchen"}`
+	deliver("m-2", withKey)
+	deliver("m-3", withKey)
+	if got := version(); got != device.Version+2 {
+		t.Errorf("Expected producer retry to be applied once (version %d), got version %d", device.Version+2, got)
+	}
+
+	// Once the retention has passed the message is processed again
+	clock.Advance(2 * time.Hour)
+	deliver("m-1", body)
+	if got := version(); got != device.Version+3 {
+		t.Errorf("Expected message to be reprocessed after retention (version %d), got version %d", device.Version+3, got)
+	}
+}
@@ -0,0 +1,169 @@
+// Package httpserver serves API Gateway handlers over plain net/http so the
+// API can run outside Lambda.
+package httpserver
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/handlers"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// pathParamRegex matches "{name}" segments of an API Gateway resource
+var pathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+
+// NewHandler returns an http.Handler serving routes. API Gateway resource
+// paths use the same "{name}" syntax as http.ServeMux patterns, so routes are
+// registered as declared. Unknown paths and methods get the same JSON errors
+// as the mono-Lambda router instead of ServeMux's plain-text ones.
+func NewHandler(routes []handlers.Route, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+	allowed := make(map[string][]string)
+	for _, route := range routes {
+		mux.HandleFunc(route.Method+" "+route.Resource, adapt(route, logger))
+		allowed[route.Resource] = append(allowed[route.Resource], route.Method)
+	}
+
+	// Patterns without a method are less specific than the routes above, so
+	// they only see requests whose method no route of the resource accepts
+	for resource, methods := range allowed {
+		sort.Strings(methods)
+		mux.HandleFunc(resource, methodNotAllowed(methods, logger))
+	}
+	mux.HandleFunc("/", routeNotFound(logger))
+
+	return mux
+}
+
+func methodNotAllowed(methods []string, logger *zap.Logger) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Warn("method not allowed",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		)
+		response := errors.ErrMethodNotAllowed.ToResponse()
+		response.Headers["Allow"] = allow
+		writeResponse(w, response, logger)
+	}
+}
+
+func routeNotFound(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Warn("route not found",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		)
+		writeResponse(w, errors.ErrRouteNotFound.ToResponse(), logger)
+	}
+}
+
+// adapt converts an http.Request into an APIGatewayProxyRequest, invokes the
+// route handler and writes its APIGatewayProxyResponse back
+func adapt(route handlers.Route, logger *zap.Logger) http.HandlerFunc {
+	paramNames := pathParamNames(route.Resource)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		request, err := toProxyRequest(r, route.Resource, paramNames)
+		if err != nil {
+			logger.Warn("failed to read request body", zap.Error(err))
+			writeResponse(w, errors.ErrInvalidRequest.WithMessage("Failed to read request body").ToResponse(), logger)
+			return
+		}
+
+		response, err := route.Handler(r.Context(), request)
+		if err != nil {
+			logger.Error("handler returned an error",
+				zap.String("method", route.Method),
+				zap.String("resource", route.Resource),
+				zap.Error(err),
+			)
+			response = errors.ErrInternalServer.ToResponse()
+		}
+
+		writeResponse(w, response, logger)
+	}
+}
+
+func pathParamNames(resource string) []string {
+	var names []string
+	for _, match := range pathParamRegex.FindAllStringSubmatch(resource, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+func toProxyRequest(r *http.Request, resource string, paramNames []string) (events.APIGatewayProxyRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Resource:   resource,
+		Path:       r.URL.Path,
+		HTTPMethod: r.Method,
+		Body:       string(body),
+	}
+
+	if len(r.Header) > 0 {
+		request.Headers = make(map[string]string, len(r.Header))
+		request.MultiValueHeaders = make(map[string][]string, len(r.Header))
+		for name, values := range r.Header {
+			request.Headers[name] = values[len(values)-1]
+			request.MultiValueHeaders[name] = values
+		}
+	}
+
+	if query := r.URL.Query(); len(query) > 0 {
+		request.QueryStringParameters = make(map[string]string, len(query))
+		request.MultiValueQueryStringParameters = make(map[string][]string, len(query))
+		for name, values := range query {
+			request.QueryStringParameters[name] = values[len(values)-1]
+			request.MultiValueQueryStringParameters[name] = values
+		}
+	}
+
+	if len(paramNames) > 0 {
+		request.PathParameters = make(map[string]string, len(paramNames))
+		for _, name := range paramNames {
+			request.PathParameters[name] = r.PathValue(name)
+		}
+	}
+
+	return request, nil
+}
+
+func writeResponse(w http.ResponseWriter, response events.APIGatewayProxyResponse, logger *zap.Logger) {
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			logger.Error("failed to decode base64 response body", zap.Error(err))
+			response = errors.ErrInternalServer.ToResponse()
+			decoded = []byte(response.Body)
+		}
+		body = decoded
+	}
+
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	w.WriteHeader(response.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		logger.Warn("failed to write response body", zap.Error(err))
+	}
+}
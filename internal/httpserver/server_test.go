@@ -0,0 +1,101 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/smart-devices/internal/handlers"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+func TestNewHandler_AdaptsRequestAndResponse(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	routes := []handlers.Route{
+		{
+			Method:   "PUT",
+			Resource: "/devices/{id}",
+			Handler: func(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				got = request
+				return events.APIGatewayProxyResponse{
+					StatusCode: 200,
+					Headers:    map[string]string{"ETag": `"2"`},
+					Body:       `{"ok":true}`,
+				}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest("PUT", "/devices/abc?limit=5", strings.NewReader(`{"name":"x"}`))
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	NewHandler(routes, zap.NewNop()).ServeHTTP(rec, req)
+
+	if got.HTTPMethod != "PUT" || got.Resource != "/devices/{id}" || got.Path != "/devices/abc" {
+		t.Errorf("Unexpected method/resource/path: %s %s %s", got.HTTPMethod, got.Resource, got.Path)
+	}
+	if got.PathParameters["id"] != "abc" {
+		t.Errorf("Expected path parameter id=abc, got %q", got.PathParameters["id"])
+	}
+	if got.QueryStringParameters["limit"] != "5" {
+		t.Errorf("Expected query parameter limit=5, got %q", got.QueryStringParameters["limit"])
+	}
+	if got.Headers["If-Match"] != `"1"` {
+		t.Errorf("Expected If-Match header, got %q", got.Headers["If-Match"])
+	}
+	if got.Body != `{"name":"x"}` {
+		t.Errorf("Expected body to be passed through, got %q", got.Body)
+	}
+
+	if rec.Code != 200 {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected ETag header, got %q", rec.Header().Get("ETag"))
+	}
+	if rec.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected response body to be written, got %q", rec.Body.String())
+	}
+}
+
+func TestNewHandler_UnknownRoute(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewHandler(nil, zap.NewNop()).ServeHTTP(rec, httptest.NewRequest("GET", "/unknown", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON error, got Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"ROUTE_NOT_FOUND"`) {
+		t.Errorf("Expected ROUTE_NOT_FOUND, got %s", rec.Body.String())
+	}
+}
+
+func TestNewHandler_MethodNotAllowed(t *testing.T) {
+	ok := func(_ context.Context, _ events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	}
+	routes := []handlers.Route{
+		{Method: "PUT", Resource: "/devices/{id}", Handler: ok},
+		{Method: "GET", Resource: "/devices/{id}", Handler: ok},
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(routes, zap.NewNop()).ServeHTTP(rec, httptest.NewRequest("POST", "/devices/abc", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+	if rec.Header().Get("Allow") != "GET, PUT" {
+		t.Errorf("Expected Allow: GET, PUT, got %q", rec.Header().Get("Allow"))
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"METHOD_NOT_ALLOWED"`) {
+		t.Errorf("Expected METHOD_NOT_ALLOWED, got %s", rec.Body.String())
+	}
+}
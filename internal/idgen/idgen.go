@@ -0,0 +1,16 @@
+package idgen
+
+import "github.com/google/uuid"
+
+// IDGenerator produces identifiers for newly created entities
+type IDGenerator interface {
+	NewID() string
+}
+
+// UUIDGenerator generates random version 4 UUIDs
+type UUIDGenerator struct{}
+
+// NewID returns a new random UUID string
+func (UUIDGenerator) NewID() string {
+	return uuid.New().String()
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"strings"
+
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
@@ -13,6 +15,26 @@ type Device struct {
 	HomeID     string `json:"homeId" dynamodbav:"homeId"`
 	CreatedAt  int64  `json:"createdAt" dynamodbav:"createdAt"`
 	ModifiedAt int64  `json:"modifiedAt" dynamodbav:"modifiedAt"`
+	Version    int64  `json:"version" dynamodbav:"version"`
+	// DeletedAt marks a soft-deleted device (Unix milliseconds). Tombstoned
+	// devices are hidden from reads and purged by TTL at ExpiresAt (Unix
+	// seconds) unless restored first.
+	DeletedAt int64 `json:"deletedAt,omitempty" dynamodbav:"deletedAt,omitempty"`
+	ExpiresAt int64 `json:"-" dynamodbav:"expiresAt,omitempty"`
+}
+
+// DeleteDeviceResponse is the body of a successful DELETE /devices/{id}. Device
+// is the device as deleted, including its deletedAt timestamp.
+type DeleteDeviceResponse struct {
+	Message string  `json:"message"`
+	Device  *Device `json:"device"`
+}
+
+// DevicePage is a single page of a paginated device listing. NextToken is
+// empty when there are no more pages.
+type DevicePage struct {
+	Items     []Device `json:"items"`
+	NextToken string   `json:"nextToken,omitempty"`
 }
 
 type CreateDeviceRequest struct {
@@ -28,10 +50,189 @@ type UpdateDeviceRequest struct {
 	HomeID *string `json:"homeId,omitempty" validate:"omitempty,uuid"`
 }
 
+// Home is a place devices are assigned to. Timezone is an IANA time zone name
+// and Owner the ID of the user the home belongs to.
+type Home struct {
+	ID         string `json:"id" dynamodbav:"id"`
+	Name       string `json:"name" dynamodbav:"name"`
+	Address    string `json:"address,omitempty" dynamodbav:"address,omitempty"`
+	Timezone   string `json:"timezone" dynamodbav:"timezone"`
+	Owner      string `json:"owner" dynamodbav:"owner"`
+	CreatedAt  int64  `json:"createdAt" dynamodbav:"createdAt"`
+	ModifiedAt int64  `json:"modifiedAt" dynamodbav:"modifiedAt"`
+	Version    int64  `json:"version" dynamodbav:"version"`
+	// DeviceCount is the number of active devices assigned to the home. The
+	// device repository keeps it in the same write as every assignment, and a
+	// home is only deleted while it is zero.
+	DeviceCount int64 `json:"deviceCount" dynamodbav:"deviceCount"`
+}
+
+// HomePage is a single page of a paginated home listing. NextToken is empty
+// when there are no more pages.
+type HomePage struct {
+	Items     []Home `json:"items"`
+	NextToken string `json:"nextToken,omitempty"`
+}
+
+// CreateHomeRequest is the body of POST /homes. Owner defaults to the caller.
+type CreateHomeRequest struct {
+	Name     string `json:"name" validate:"required,min=1,max=100"`
+	Address  string `json:"address,omitempty" validate:"omitempty,max=200"`
+	Timezone string `json:"timezone" validate:"required,timezone"`
+	Owner    string `json:"owner,omitempty" validate:"omitempty,max=100"`
+}
+
+// UpdateHomeRequest is the body of PUT /homes/{homeId}. An empty address
+// clears it.
+type UpdateHomeRequest struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1,max=100"`
+	Address  *string `json:"address,omitempty" validate:"omitempty,max=200"`
+	Timezone *string `json:"timezone,omitempty" validate:"omitempty,timezone"`
+	Owner    *string `json:"owner,omitempty" validate:"omitempty,min=1,max=100"`
+}
+
+// Device lifecycle event types published by DeviceService
+const (
+	EventDeviceCreated     = "device.created"
+	EventDeviceUpdated     = "device.updated"
+	EventDeviceDeleted     = "device.deleted"
+	EventDeviceHomeChanged = "device.home_changed"
+	EventDeviceRestored    = "device.restored"
+)
+
+// DeviceEvent describes one change to a device. Before is nil for
+// device.created and device.restored, and After is nil for device.deleted.
+type DeviceEvent struct {
+	ID         string  `json:"id"`
+	Type       string  `json:"type"`
+	DeviceID   string  `json:"deviceId"`
+	OccurredAt int64   `json:"occurredAt"`
+	Before     *Device `json:"before,omitempty"`
+	After      *Device `json:"after,omitempty"`
+}
+
+// DeviceChange is the stored device a write replaced and the device it wrote.
+// After of a delete is the tombstone.
+type DeviceChange struct {
+	Before *Device
+	After  *Device
+}
+
+// Sources a device change can come from
+const (
+	SourceHTTP = "http"
+	SourceSQS  = "sqs"
+)
+
+// FieldChange is the old and new value of one device field. Values are
+// empty when the field was not set, e.g. Old on create.
+type FieldChange struct {
+	Field string `json:"field" dynamodbav:"field"`
+	Old   string `json:"old" dynamodbav:"old"`
+	New   string `json:"new" dynamodbav:"new"`
+}
+
+// FieldChanges lists the device fields that differ between the stored images
+// before and after a change. A nil before (a create) counts as having every
+// field empty; deletes and restores only move the tombstone and list none.
+func FieldChanges(before *Device, after *Device) []FieldChange {
+	var old, updated Device
+	if before != nil {
+		old = *before
+	}
+	if after != nil {
+		updated = *after
+	}
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"mac", old.MAC, updated.MAC},
+		{"name", old.Name, updated.Name},
+		{"type", old.Type, updated.Type},
+		{"homeId", old.HomeID, updated.HomeID},
+	}
+
+	changes := []FieldChange{}
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, FieldChange{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	return changes
+}
+
+// DeviceHistoryEntry records one change to a device: Type is the device event
+// type of the change, Actor who made it and Source the entrypoint it came
+// through. Timestamp is in Unix milliseconds.
+type DeviceHistoryEntry struct {
+	DeviceID  string        `json:"deviceId" dynamodbav:"deviceId"`
+	ID        string        `json:"id" dynamodbav:"id"`
+	Type      string        `json:"type" dynamodbav:"type"`
+	Actor     string        `json:"actor" dynamodbav:"actor"`
+	Source    string        `json:"source" dynamodbav:"source"`
+	Changes   []FieldChange `json:"changes" dynamodbav:"changes"`
+	Timestamp int64         `json:"timestamp" dynamodbav:"timestamp"`
+}
+
+// DeviceHistoryPage is a page of a device's history, newest first
+type DeviceHistoryPage struct {
+	Items     []DeviceHistoryEntry `json:"items"`
+	NextToken string               `json:"nextToken,omitempty"`
+}
+
+// Outbox entry statuses
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+)
+
+// OutboxEntry is a DeviceEvent recorded in the outbox table in the same
+// transaction as the change it describes. Event holds the JSON-encoded event
+// and ExpiresAt (Unix seconds) drives the table's TTL.
+type OutboxEntry struct {
+	ID        string `json:"id" dynamodbav:"id"`
+	DeviceID  string `json:"deviceId" dynamodbav:"deviceId"`
+	EventType string `json:"eventType" dynamodbav:"eventType"`
+	Event     string `json:"event" dynamodbav:"event"`
+	Status    string `json:"status" dynamodbav:"status"`
+	CreatedAt int64  `json:"createdAt" dynamodbav:"createdAt"`
+	SentAt    int64  `json:"sentAt,omitempty" dynamodbav:"sentAt,omitempty"`
+	ExpiresAt int64  `json:"expiresAt" dynamodbav:"expiresAt"`
+}
+
+// SQS message actions. Messages without an action, or with the legacy
+// ActionAssociate, are treated as ActionAssignHome, which was the only
+// behavior before actions existed.
+const (
+	ActionAssociate    = "associate"
+	ActionAssignHome   = "assign_home"
+	ActionUnassignHome = "unassign_home"
+	ActionRename       = "rename"
+	ActionDelete       = "delete"
+	ActionCreate       = "create"
+)
+
+// SQSMessageSchemaVersion is the newest SQSMessage schema this build
+// understands. Messages without a schemaVersion are version 1.
+const SQSMessageSchemaVersion = 1
+
 type SQSMessage struct {
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// MessageID optionally identifies the message for deduplication across
+	// producer retries; the SQS message ID is used when it is empty
+	MessageID string `json:"messageId,omitempty"`
+	// Actor optionally names who sent the message; it is recorded in the
+	// device history
+	Actor    string `json:"actor,omitempty"`
 	DeviceID string `json:"deviceId"`
 	HomeID   string `json:"homeId"`
 	Action   string `json:"action"`
+	// Name, MAC and Type are only used by the rename and create actions
+	Name string `json:"name,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+	Type string `json:"type,omitempty"`
 }
 
 // ToMap converts Device to map[string]types.AttributeValue for DynamoDB
@@ -43,3 +244,9 @@ func (d *Device) ToMap() (map[string]types.AttributeValue, error) {
 func (d *Device) FromMap(item map[string]types.AttributeValue) error {
 	return attributevalue.UnmarshalMap(item, d)
 }
+
+// NormalizeMAC returns the canonical form of a MAC address: upper case with
+// ':' separators, so "aa-bb-cc-dd-ee-ff" and "AA:BB:CC:DD:EE:FF" compare equal
+func NormalizeMAC(mac string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(mac), "-", ":"))
+}
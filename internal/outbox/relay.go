@@ -0,0 +1,137 @@
+// Package outbox delivers device events recorded in the outbox table to the
+// configured publisher. The relay consumes the table's DynamoDB stream, so
+// every entry written with a device change reaches the publisher even when
+// the writer crashed right after its transaction.
+//
+// Delivery is at least once: an entry is marked sent after it was published
+// and redeliveries of sent entries are skipped, but a crash in between
+// publishes it again. Consumers deduplicate on the event ID.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// Store tracks which outbox entries were delivered
+type Store interface {
+	IsSent(ctx context.Context, id string) (bool, error)
+	MarkSent(ctx context.Context, id string) error
+}
+
+type Relay struct {
+	store     Store
+	publisher services.EventPublisher
+	logger    *zap.Logger
+}
+
+func NewRelay(store Store, publisher services.EventPublisher, logger *zap.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		logger:    logger,
+	}
+}
+
+// HandleStream delivers the outbox entries inserted in the batch. Lambda
+// retries a shard from the first reported failure, so processing stops there
+// and the remaining records are retried after it, keeping events in order
+// (requires ReportBatchItemFailures on the event source mapping).
+func (r *Relay) HandleStream(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	var response events.DynamoDBEventResponse
+
+	for _, record := range event.Records {
+		if err := r.relay(ctx, record); err != nil {
+			r.logger.Error("failed to relay outbox entry",
+				zap.String("sequence_number", record.Change.SequenceNumber),
+				zap.Error(err),
+			)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+			break
+		}
+	}
+
+	return response, nil
+}
+
+// relay publishes the entry inserted by record. Other stream records (marking
+// an entry sent, TTL deletes) are ignored.
+func (r *Relay) relay(ctx context.Context, record events.DynamoDBEventRecord) error {
+	if record.EventName != string(events.DynamoDBOperationTypeInsert) {
+		return nil
+	}
+
+	id, deviceEvent, err := decodeEntry(record.Change.NewImage)
+	if err != nil {
+		// Retrying cannot repair the entry, so it is skipped
+		r.logger.Error("dropping malformed outbox entry",
+			zap.String("sequence_number", record.Change.SequenceNumber),
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	sent, err := r.store.IsSent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sent {
+		r.logger.Info("outbox entry already sent", zap.String("entry_id", id))
+		return nil
+	}
+
+	if err := r.publisher.Publish(ctx, deviceEvent); err != nil {
+		return err
+	}
+
+	// The event is out; failing here would only publish it again
+	if err := r.store.MarkSent(ctx, id); err != nil {
+		r.logger.Warn("failed to mark outbox entry sent",
+			zap.String("entry_id", id),
+			zap.Error(err),
+		)
+	}
+
+	r.logger.Info("outbox entry relayed",
+		zap.String("entry_id", id),
+		zap.String("event_type", deviceEvent.Type),
+		zap.String("device_id", deviceEvent.DeviceID),
+	)
+	return nil
+}
+
+// decodeEntry reads the ID and event of a models.OutboxEntry stream image
+func decodeEntry(image map[string]events.DynamoDBAttributeValue) (string, models.DeviceEvent, error) {
+	var deviceEvent models.DeviceEvent
+
+	id, ok := image["id"]
+	if !ok || id.DataType() != events.DataTypeString {
+		return "", deviceEvent, errors.NewDomainError(errors.ErrorTypeValidation, "outbox entry has no id").
+			WithOperation("DecodeEntry").
+			WithLayer("outbox")
+	}
+	body, ok := image["event"]
+	if !ok || body.DataType() != events.DataTypeString {
+		return "", deviceEvent, errors.NewDomainError(errors.ErrorTypeValidation, "outbox entry has no event").
+			WithOperation("DecodeEntry").
+			WithLayer("outbox").
+			WithContext("entry_id", id.String())
+	}
+
+	if err := json.Unmarshal([]byte(body.String()), &deviceEvent); err != nil {
+		return "", deviceEvent, errors.WrapError(errors.ErrorTypeValidation, "malformed outbox event", err).
+			WithOperation("DecodeEntry").
+			WithLayer("outbox").
+			WithContext("entry_id", id.String())
+	}
+
+	return id.String(), deviceEvent, nil
+}
@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"reflect"
+	"testing"
+
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/publisher"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	sent map[string]bool
+}
+
+func (s *fakeStore) IsSent(_ context.Context, id string) (bool, error) {
+	return s.sent[id], nil
+}
+
+func (s *fakeStore) MarkSent(_ context.Context, id string) error {
+	s.sent[id] = true
+	return nil
+}
+
+// failingPublisher fails for the event with failID, if set, and records the
+// others
+type failingPublisher struct {
+	*publisher.MemoryPublisher
+	failID string
+}
+
+func (p failingPublisher) Publish(ctx context.Context, event models.DeviceEvent) error {
+	if event.ID == p.failID {
+		return stderrors.New("queue unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+func insertRecord(t *testing.T, sequence string, event models.DeviceEvent) events.DynamoDBEventRecord {
+	t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+	return events.DynamoDBEventRecord{
+		EventName: string(events.DynamoDBOperationTypeInsert),
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: sequence,
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"id":     events.NewStringAttribute(event.ID),
+				"event":  events.NewStringAttribute(string(body)),
+				"status": events.NewStringAttribute(models.OutboxStatusPending),
+			},
+		},
+	}
+}
+
+func TestRelay_HandleStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		sent          []string
+		failID        string
+		records       func(t *testing.T) []events.DynamoDBEventRecord
+		wantFailures  []string
+		wantPublished []string
+		wantPending   []string
+	}{
+		{
+			name: "publishes new entries",
+			sent: []string{"event-2"},
+			records: func(t *testing.T) []events.DynamoDBEventRecord {
+				return []events.DynamoDBEventRecord{
+					insertRecord(t, "1", models.DeviceEvent{ID: "event-1", Type: models.EventDeviceCreated, DeviceID: "device-1"}),
+					// Redelivery of an entry that was already published
+					insertRecord(t, "2", models.DeviceEvent{ID: "event-2", Type: models.EventDeviceUpdated, DeviceID: "device-1"}),
+					// Marking an entry sent modifies it; that record is not an event
+					{EventName: string(events.DynamoDBOperationTypeModify), Change: events.DynamoDBStreamRecord{SequenceNumber: "3"}},
+					// Malformed entries are dropped instead of blocking the shard
+					{EventName: string(events.DynamoDBOperationTypeInsert), Change: events.DynamoDBStreamRecord{SequenceNumber: "4"}},
+					insertRecord(t, "5", models.DeviceEvent{ID: "event-5", Type: models.EventDeviceDeleted, DeviceID: "device-1"}),
+				}
+			},
+			wantPublished: []string{"event-1", "event-5"},
+		},
+		{
+			name:   "stops at the first failure",
+			failID: "event-2",
+			records: func(t *testing.T) []events.DynamoDBEventRecord {
+				return []events.DynamoDBEventRecord{
+					insertRecord(t, "1", models.DeviceEvent{ID: "event-1", Type: models.EventDeviceCreated}),
+					insertRecord(t, "2", models.DeviceEvent{ID: "event-2", Type: models.EventDeviceUpdated}),
+					insertRecord(t, "3", models.DeviceEvent{ID: "event-3", Type: models.EventDeviceDeleted}),
+				}
+			},
+			wantFailures:  []string{"2"},
+			wantPublished: []string{"event-1"},
+			wantPending:   []string{"event-2", "event-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{sent: make(map[string]bool)}
+			for _, id := range tt.sent {
+				store.sent[id] = true
+			}
+			memory := publisher.NewMemoryPublisher()
+			relay := NewRelay(store, failingPublisher{MemoryPublisher: memory, failID: tt.failID}, zap.NewNop())
+
+			response, err := relay.HandleStream(context.Background(), events.DynamoDBEvent{Records: tt.records(t)})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var failures []string
+			for _, failure := range response.BatchItemFailures {
+				failures = append(failures, failure.ItemIdentifier)
+			}
+			if !reflect.DeepEqual(failures, tt.wantFailures) {
+				t.Errorf("Expected failures %v, got %v", tt.wantFailures, failures)
+			}
+
+			var published []string
+			for _, event := range memory.Events() {
+				published = append(published, event.ID)
+			}
+			if !reflect.DeepEqual(published, tt.wantPublished) {
+				t.Errorf("Expected %v to be published, got %v", tt.wantPublished, published)
+			}
+			for _, id := range tt.wantPublished {
+				if !store.sent[id] {
+					t.Errorf("Expected published entry %s to be marked sent", id)
+				}
+			}
+			for _, id := range tt.wantPending {
+				if store.sent[id] {
+					t.Errorf("Expected entry %s to stay pending", id)
+				}
+			}
+		})
+	}
+}
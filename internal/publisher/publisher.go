@@ -0,0 +1,100 @@
+// Package publisher provides the services.EventPublisher implementations:
+// SQS for deployments, Memory for tests and local runs, and Noop.
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+)
+
+// SQSSender is the subset of *sqs.Client used by SQSPublisher
+type SQSSender interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// SQSPublisher sends each event as a JSON message. The event type is also set
+// as the eventType message attribute so consumers can filter without parsing.
+type SQSPublisher struct {
+	client   SQSSender
+	queueURL string
+	logger   *zap.Logger
+}
+
+func NewSQSPublisher(client SQSSender, queueURL string, logger *zap.Logger) *SQSPublisher {
+	return &SQSPublisher{
+		client:   client,
+		queueURL: queueURL,
+		logger:   logger,
+	}
+}
+
+func (p *SQSPublisher) Publish(ctx context.Context, event models.DeviceEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.WrapError(errors.ErrorTypeInternal, "failed to marshal device event", err).
+			WithOperation("Publish").
+			WithContext("event_id", event.ID)
+	}
+
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"eventType": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+		},
+	})
+	if err != nil {
+		return errors.WrapError(errors.ErrorTypeExternal, "failed to send device event", err).
+			WithOperation("Publish").
+			WithContext("event_id", event.ID).
+			WithContext("event_type", event.Type)
+	}
+
+	p.logger.Debug("device event published",
+		zap.String("event_id", event.ID),
+		zap.String("event_type", event.Type),
+		zap.String("device_id", event.DeviceID),
+	)
+	return nil
+}
+
+// MemoryPublisher records published events in order
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []models.DeviceEvent
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event models.DeviceEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns a copy of the events published so far
+func (p *MemoryPublisher) Events() []models.DeviceEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]models.DeviceEvent(nil), p.events...)
+}
+
+// Noop discards every event
+type Noop struct{}
+
+func (Noop) Publish(context.Context, models.DeviceEvent) error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"testing"
+
+	domainerrors "example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.uber.org/zap"
+)
+
+type fakeSender struct {
+	sent []*sqs.SendMessageInput
+	err  error
+}
+
+func (f *fakeSender) SendMessage(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.sent = append(f.sent, params)
+	return &sqs.SendMessageOutput{MessageId: aws.String("m-1")}, nil
+}
+
+func TestSQSPublisher_Publish(t *testing.T) {
+	sender := &fakeSender{}
+	publisher := NewSQSPublisher(sender, "http://localhost:9324/queue/events", zap.NewNop())
+
+	event := models.DeviceEvent{
+		ID:         "event-1",
+		Type:       models.EventDeviceHomeChanged,
+		DeviceID:   "device-1",
+		OccurredAt: 1704067200000,
+		Before:     &models.Device{ID: "device-1", HomeID: "home-1"},
+		After:      &models.Device{ID: "device-1", HomeID: "home-2"},
+	}
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(sender.sent) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(sender.sent))
+	}
+	sent := sender.sent[0]
+	if aws.ToString(sent.QueueUrl) != "http://localhost:9324/queue/events" {
+		t.Errorf("Expected events queue, got %s", aws.ToString(sent.QueueUrl))
+	}
+	if attribute := sent.MessageAttributes["eventType"]; aws.ToString(attribute.StringValue) != models.EventDeviceHomeChanged {
+		t.Errorf("Expected eventType attribute %s, got %+v", models.EventDeviceHomeChanged, attribute)
+	}
+
+	var decoded models.DeviceEvent
+	if err := json.Unmarshal([]byte(aws.ToString(sent.MessageBody)), &decoded); err != nil {
+		t.Fatalf("Expected JSON body, got %v", err)
+	}
+	if decoded.ID != "event-1" || decoded.Before.HomeID != "home-1" || decoded.After.HomeID != "home-2" {
+		t.Errorf("Expected event to round-trip, got %+v", decoded)
+	}
+}
+
+func TestSQSPublisher_Publish_SendError(t *testing.T) {
+	publisher := NewSQSPublisher(&fakeSender{err: stderrors.New("throttled")}, "queue", zap.NewNop())
+
+	err := publisher.Publish(context.Background(), models.DeviceEvent{ID: "event-1", Type: models.EventDeviceCreated})
+	if !stderrors.Is(err, domainerrors.NewDomainError(domainerrors.ErrorTypeExternal, "")) {
+		t.Errorf("Expected external error, got %v", err)
+	}
+}
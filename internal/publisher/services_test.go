@@ -0,0 +1,14 @@
+package publisher_test
+
+import (
+	"example.com/smart-devices/internal/publisher"
+	"example.com/smart-devices/internal/services"
+)
+
+// The services package defaults to Noop and so cannot be imported by
+// publisher itself
+var (
+	_ services.EventPublisher = (*publisher.SQSPublisher)(nil)
+	_ services.EventPublisher = (*publisher.MemoryPublisher)(nil)
+	_ services.EventPublisher = publisher.Noop{}
+)
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/services"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// Dedup item statuses
+const (
+	dedupStatusProcessing = "processing"
+	dedupStatusDone       = "done"
+)
+
+// DedupStore records processed SQS messages in a DynamoDB table keyed on
+// messageId. expiresAt (Unix seconds) is the table's TTL attribute: it ends
+// the lease of an in-flight claim and the retention of a completed one, and
+// DynamoDB deletes the item some time afterwards.
+type DedupStore struct {
+	client    *dynamodb.Client
+	tableName string
+	clock     clock.Clock
+	lease     time.Duration
+	retention time.Duration
+	logger    *zap.Logger
+}
+
+// NewDedupStore creates a dedup store. lease should cover the time needed to
+// process a message (the queue's visibility timeout) and retention the window
+// in which redeliveries are expected.
+func NewDedupStore(client *dynamodb.Client, tableName string, clk clock.Clock, lease time.Duration, retention time.Duration, logger *zap.Logger) *DedupStore {
+	return &DedupStore{
+		client:    client,
+		tableName: tableName,
+		clock:     clk,
+		lease:     lease,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+func (s *DedupStore) Claim(ctx context.Context, key string) (services.ClaimStatus, error) {
+	s.logger.Debug("claiming message", zap.String("dedup_key", key))
+
+	now := s.clock.Now()
+
+	// Items whose expiresAt has passed may not have been deleted by TTL yet,
+	// so they are treated as absent
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item: map[string]types.AttributeValue{
+			"messageId": &types.AttributeValueMemberS{Value: key},
+			"status":    &types.AttributeValueMemberS{Value: dedupStatusProcessing},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.lease).Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(messageId) OR expiresAt < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionErr) {
+			// The existing item is unexpired; its status tells a completed
+			// message from one another delivery is still processing
+			if status, ok := conditionErr.Item["status"].(*types.AttributeValueMemberS); ok && status.Value == dedupStatusDone {
+				return services.ClaimDone, nil
+			}
+			return services.ClaimInFlight, nil
+		}
+
+		s.logger.Error("failed to claim message", zap.String("dedup_key", key), zap.Error(err))
+		return services.ClaimAcquired, errors.WrapError(errors.ErrorTypeDatabase, "failed to claim message", err).
+			WithOperation("Claim").
+			WithLayer("repository").
+			WithContext("dedup_key", key)
+	}
+
+	return services.ClaimAcquired, nil
+}
+
+func (s *DedupStore) Complete(ctx context.Context, key string) error {
+	s.logger.Debug("completing message", zap.String("dedup_key", key))
+
+	expiresAt := s.clock.Now().Add(s.retention).Unix()
+
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item: map[string]types.AttributeValue{
+			"messageId": &types.AttributeValueMemberS{Value: key},
+			"status":    &types.AttributeValueMemberS{Value: dedupStatusDone},
+			"expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+	})
+	if err != nil {
+		s.logger.Error("failed to complete message", zap.String("dedup_key", key), zap.Error(err))
+		return errors.WrapError(errors.ErrorTypeDatabase, "failed to complete message", err).
+			WithOperation("Complete").
+			WithLayer("repository").
+			WithContext("dedup_key", key)
+	}
+
+	return nil
+}
+
+func (s *DedupStore) Release(ctx context.Context, key string) error {
+	s.logger.Debug("releasing message", zap.String("dedup_key", key))
+
+	// Only in-flight claims are released; a completed message stays recorded
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &s.tableName,
+		Key: map[string]types.AttributeValue{
+			"messageId": &types.AttributeValueMemberS{Value: key},
+		},
+		ConditionExpression: aws.String("#status = :processing"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":processing": &types.AttributeValueMemberS{Value: dedupStatusProcessing},
+		},
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionErr) {
+			return nil
+		}
+
+		s.logger.Error("failed to release message", zap.String("dedup_key", key), zap.Error(err))
+		return errors.WrapError(errors.ErrorTypeDatabase, "failed to release message", err).
+			WithOperation("Release").
+			WithLayer("repository").
+			WithContext("dedup_key", key)
+	}
+
+	return nil
+}
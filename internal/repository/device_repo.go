@@ -2,32 +2,76 @@ package repository
 
 import (
 	"context"
+	stderrors "errors"
+	"example.com/smart-devices/internal/clock"
 	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
 	"example.com/smart-devices/internal/models"
-	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// homeIDIndexName is the global secondary index keyed on homeId
+const homeIDIndexName = "homeId-index"
+
+// defaultTombstoneRetention is how long a deleted device stays restorable
+// unless WithTombstoneRetention says otherwise
+const defaultTombstoneRetention = 30 * 24 * time.Hour
+
+// activeDeviceFilter skips soft-deleted devices in scans and queries
+const activeDeviceFilter = "attribute_not_exists(#deletedAt)"
+
+// updateAttempts bounds how often transactUpdate retries when the device
+// changes between the read and the transaction
+const updateAttempts = 3
+
 type DeviceRepository struct {
-	client    *dynamodb.Client
-	tableName string
-	logger    *zap.Logger
+	client           *dynamodb.Client
+	tableName        string
+	macTableName     string
+	historyTableName string
+	homesTableName   string
+	clock            clock.Clock
+	ids              idgen.IDGenerator
+	outbox           *outbox
+	retention        time.Duration
+	logger           *zap.Logger
+}
+
+// NewDeviceRepository creates a repository backed by the devices table.
+// macTableName holds one lookup item per normalized MAC address and is
+// written in the same transaction as the device to keep MACs unique.
+// All createdAt/modifiedAt values are taken from clk in Unix milliseconds
+// and new device IDs come from ids. Deleted devices are kept as tombstones
+// (see DeleteDevice) for 30 days unless WithTombstoneRetention is given.
+func NewDeviceRepository(client *dynamodb.Client, tableName string, macTableName string, clk clock.Clock, ids idgen.IDGenerator, logger *zap.Logger, opts ...DeviceRepositoryOption) *DeviceRepository {
+	r := &DeviceRepository{
+		client:       client,
+		tableName:    tableName,
+		macTableName: macTableName,
+		clock:        clk,
+		ids:          ids,
+		retention:    defaultTombstoneRetention,
+		logger:       logger,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func NewDeviceRepository(client *dynamodb.Client, tableName string, logger *zap.Logger) *DeviceRepository {
-	//func NewDeviceRepository(client *dynamodb.Client, tableName string) *DeviceRepository {
-	return &DeviceRepository{
-		client:    client,
-		tableName: tableName,
-		logger:    logger,
+// WithTombstoneRetention sets how long a deleted device can be restored
+// before DynamoDB TTL purges it. The devices table must have TTL enabled on
+// expiresAt.
+func WithTombstoneRetention(retention time.Duration) DeviceRepositoryOption {
+	return func(r *DeviceRepository) {
+		r.retention = retention
 	}
 }
 
@@ -76,15 +120,46 @@ func (r *DeviceRepository) GetDevice(ctx context.Context, id string) (*models.De
 			WithContext("device_id", id)
 	}
 
+	// A soft-deleted device is only visible to RestoreDevice
+	if device.DeletedAt != 0 {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("GetDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+
 	return &device, nil
 }
 
-func (r *DeviceRepository) GetDevices(ctx context.Context) ([]models.Device, error) {
-	r.logger.Debug("fetching devices")
+func (r *DeviceRepository) GetDevices(ctx context.Context, limit int32, nextToken string) (*models.DevicePage, error) {
+	r.logger.Debug("fetching devices",
+		zap.Int32("limit", limit),
+		zap.Bool("has_next_token", nextToken != ""),
+	)
+
+	// Limit applies before the filter, so a page may hold fewer than limit
+	// devices (or none) and still be followed by more
+	input := &dynamodb.ScanInput{
+		TableName:        &r.tableName,
+		FilterExpression: aws.String(activeDeviceFilter),
+		ExpressionAttributeNames: map[string]string{
+			"#deletedAt": "deletedAt",
+		},
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(limit)
+	}
+	if nextToken != "" {
+		startKey, err := decodePageToken(nextToken)
+		if err != nil {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetDevices").
+				WithLayer("repository")
+		}
+		input.ExclusiveStartKey = startKey
+	}
 
-	result, err := r.client.Scan(ctx, &dynamodb.ScanInput{
-		TableName: &r.tableName,
-	})
+	result, err := r.client.Scan(ctx, input)
 
 	if err != nil {
 		r.logger.Error("database operation failed",
@@ -100,13 +175,15 @@ func (r *DeviceRepository) GetDevices(ctx context.Context) ([]models.Device, err
 
 	r.logger.Debug("fetched devices", zap.Int32("count", result.Count))
 
-	if result.Count == 0 {
+	// An empty page is only "not found" when it is the whole table; later
+	// pages may legitimately be empty when the previous page ended the table
+	if result.Count == 0 && nextToken == "" && len(result.LastEvaluatedKey) == 0 {
 		return nil, errors.ErrDomainNoDevicesFound.
 			WithOperation("GetDevices").
 			WithLayer("repository")
 	}
 
-	var devices []models.Device
+	devices := make([]models.Device, 0, len(result.Items))
 
 	for i, item := range result.Items {
 		var device models.Device
@@ -128,41 +205,134 @@ func (r *DeviceRepository) GetDevices(ctx context.Context) ([]models.Device, err
 			WithContext("items_count", len(result.Items))
 	}
 
+	token, err := encodePageToken(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to encode pagination token", err).
+			WithOperation("GetDevices").
+			WithLayer("repository")
+	}
+
+	return &models.DevicePage{
+		Items:     devices,
+		NextToken: token,
+	}, nil
+}
+
+func (r *DeviceRepository) GetDevicesByHome(ctx context.Context, homeID string) ([]models.Device, error) {
+	r.logger.Debug("fetching devices by home", zap.String("home_id", homeID))
+
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:              &r.tableName,
+		IndexName:              aws.String(homeIDIndexName),
+		KeyConditionExpression: aws.String("#homeId = :homeId"),
+		FilterExpression:       aws.String(activeDeviceFilter),
+		ExpressionAttributeNames: map[string]string{
+			"#homeId":    "homeId",
+			"#deletedAt": "deletedAt",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":homeId": &types.AttributeValueMemberS{Value: homeID},
+		},
+	})
+
+	var items []map[string]types.AttributeValue
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			r.logger.Error("database operation failed",
+				zap.String("operation", "GetDevicesByHome"),
+				zap.String("table", r.tableName),
+				zap.String("index", homeIDIndexName),
+				zap.Error(err),
+			)
+			return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to query devices by home from database", err).
+				WithOperation("GetDevicesByHome").
+				WithLayer("repository").
+				WithContext("home_id", homeID).
+				WithContext("table", r.tableName)
+		}
+		items = append(items, page.Items...)
+	}
+
+	r.logger.Debug("fetched devices by home",
+		zap.String("home_id", homeID),
+		zap.Int("count", len(items)),
+	)
+
+	if len(items) == 0 {
+		return nil, errors.ErrDomainNoDevicesFound.
+			WithOperation("GetDevicesByHome").
+			WithLayer("repository").
+			WithContext("home_id", homeID)
+	}
+
+	devices := make([]models.Device, 0, len(items))
+
+	for i, item := range items {
+		var device models.Device
+		if err := attributevalue.UnmarshalMap(item, &device); err != nil {
+			r.logger.Error("failed to unmarshal device",
+				zap.Int("item_index", i),
+				zap.Error(err))
+			// Skip malformed items but continue processing
+			continue
+		}
+		devices = append(devices, device)
+	}
+
+	if len(devices) == 0 {
+		return nil, errors.ErrUnmarshalDevice.
+			WithOperation("GetDevicesByHome").
+			WithLayer("repository").
+			WithContext("items_count", len(items))
+	}
+
 	return devices, nil
 }
 
-func (r *DeviceRepository) DeleteDevice(ctx context.Context, id string) error {
-	r.logger.Debug("deleting device", zap.String("device_id", id))
+// GetDeviceIDByMAC returns the ID of the device the MAC is registered to, or
+// "" when no device holds it
+func (r *DeviceRepository) GetDeviceIDByMAC(ctx context.Context, mac string) (string, error) {
+	mac = models.NormalizeMAC(mac)
+	r.logger.Debug("looking up device MAC", zap.String("device_mac", mac))
 
-	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-		TableName: &r.tableName,
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &r.macTableName,
 		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{
-				Value: id,
-			},
+			"mac": &types.AttributeValueMemberS{Value: mac},
 		},
+		ConsistentRead: aws.Bool(true),
 	})
-
 	if err != nil {
 		r.logger.Error("database operation failed",
-			zap.String("operation", "DeleteDevice"),
-			zap.String("table", r.tableName),
+			zap.String("operation", "GetDeviceIDByMAC"),
+			zap.String("table", r.macTableName),
 			zap.Error(err),
 		)
-		return errors.WrapError(errors.ErrorTypeDatabase, "failed to delete device from database", err).
-			WithOperation("DeleteDevice").
+		return "", errors.WrapError(errors.ErrorTypeDatabase, "failed to look up device MAC", err).
+			WithOperation("GetDeviceIDByMAC").
 			WithLayer("repository").
-			WithContext("device_id", id).
-			WithContext("table", r.tableName)
+			WithContext("device_mac", mac).
+			WithContext("table", r.macTableName)
 	}
 
-	return nil
+	if owner, ok := result.Item["deviceId"].(*types.AttributeValueMemberS); ok {
+		return owner.Value, nil
+	}
+	return "", nil
 }
 
-func (r *DeviceRepository) UpdateDevice(ctx context.Context, id string, update models.Device) (*models.Device, error) {
-	r.logger.Debug("updating device", zap.String("device_id", id))
+// DeleteDevice soft-deletes a device: it is marked with a deletedAt
+// tombstone and hidden from reads, and DynamoDB TTL purges it once the
+// tombstone retention has passed. The MAC is released right away so the
+// hardware can be registered again; RestoreDevice reclaims it. It returns the
+// device it deleted and its tombstone, or ErrDomainDeviceNotFound when there
+// is no device to delete.
+func (r *DeviceRepository) DeleteDevice(ctx context.Context, id string, expectedVersion *int64) (*models.DeviceChange, error) {
+	r.logger.Debug("deleting device", zap.String("device_id", id))
 
-	// First, get the current device to preserve existing fields
+	// The device is read first so its MAC lookup item can be released in
+	// the same transaction
 	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: &r.tableName,
 		Key: map[string]types.AttributeValue{
@@ -170,133 +340,406 @@ func (r *DeviceRepository) UpdateDevice(ctx context.Context, id string, update m
 		},
 	})
 	if err != nil {
-		r.logger.Error("failed to get device for update",
+		r.logger.Error("failed to get device for deletion",
 			zap.String("device_id", id),
 			zap.Error(err),
 		)
-		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to get device for update", err).
-			WithOperation("UpdateDevice").
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to get device for deletion", err).
+			WithOperation("DeleteDevice").
 			WithLayer("repository").
 			WithContext("device_id", id)
 	}
-	if result.Item == nil {
+
+	var device models.Device
+	if result.Item != nil {
+		if err := device.FromMap(result.Item); err != nil {
+			r.logger.Error("failed to unmarshal device",
+				zap.String("device_id", id),
+				zap.Error(err),
+			)
+			return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal device data", err).
+				WithOperation("DeleteDevice").
+				WithLayer("repository").
+				WithContext("device_id", id)
+		}
+	}
+	// A device that was already deleted is as gone as one that never existed
+	if result.Item == nil || device.DeletedAt != 0 {
 		return nil, errors.ErrDomainDeviceNotFound.
-			WithOperation("UpdateDevice").
+			WithOperation("DeleteDevice").
 			WithLayer("repository").
 			WithContext("device_id", id)
 	}
 
-	// Unmarshal the current device
-	var currentDevice models.Device
-	if err := attributevalue.UnmarshalMap(result.Item, &currentDevice); err != nil {
-		r.logger.Error("failed to unmarshal current device",
-			zap.String("device_id", id),
-			zap.Error(err),
-		)
-		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal current device", err).
-			WithOperation("UpdateDevice").
-			WithLayer("repository").
-			WithContext("device_id", id)
+	if expectedVersion != nil && device.Version != *expectedVersion {
+		return nil, versionMismatch("DeleteDevice", id, *expectedVersion)
 	}
 
-	// Create a map of fields to update
-	updates := make(map[string]types.AttributeValue)
-
-	// Only include fields that are not zero values
-	if update.Type != "" {
-		updates[":type"] = &types.AttributeValueMemberS{Value: update.Type}
+	now := r.clock.Now()
+	deleted := device
+	deleted.DeletedAt = now.UnixMilli()
+	deleted.ExpiresAt = now.Add(r.retention).Unix()
+	deleted.ModifiedAt = deleted.DeletedAt
+	deleted.Version = device.Version + 1
+
+	names := map[string]string{
+		"#deletedAt":  "deletedAt",
+		"#expiresAt":  "expiresAt",
+		"#modifiedAt": "modifiedAt",
+		"#version":    "version",
 	}
-	if update.Name != "" {
-		updates[":name"] = &types.AttributeValueMemberS{Value: update.Name}
+	values := map[string]types.AttributeValue{
+		":deletedAt":  &types.AttributeValueMemberN{Value: strconv.FormatInt(deleted.DeletedAt, 10)},
+		":expiresAt":  &types.AttributeValueMemberN{Value: strconv.FormatInt(deleted.ExpiresAt, 10)},
+		":modifiedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(deleted.ModifiedAt, 10)},
+		":one":        &types.AttributeValueMemberN{Value: "1"},
 	}
-	if update.MAC != "" {
-		updates[":mac"] = &types.AttributeValueMemberS{Value: update.MAC}
+	condition := "attribute_exists(id) AND attribute_not_exists(#deletedAt)"
+	if expectedVersion != nil {
+		versionExpr, _, versionValues := versionCondition(*expectedVersion)
+		condition += " AND (" + versionExpr + ")"
+		for k, v := range versionValues {
+			values[k] = v
+		}
 	}
-	if update.HomeID != "" {
-		updates[":homeId"] = &types.AttributeValueMemberS{Value: update.HomeID}
+
+	var items []types.TransactWriteItem
+	if r.outbox != nil {
+		puts, err := r.outboxPuts(r.newEvent(models.EventDeviceDeleted, id, &device, nil))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, puts...)
 	}
+	// A tombstone no longer counts towards its home
+	items = append(items, r.homeUpdates(device.HomeID, "")...)
 
-	// Always update ModifiedAt
-	now := time.Now().Unix()
-	updates[":modifiedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)}
+	puts, err := r.historyPuts(ctx, models.EventDeviceDeleted, id, &device, &deleted)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, puts...)
 
-	if len(updates) == 1 { // Only ModifiedAt was updated
-		return &currentDevice, nil
+	update := types.TransactWriteItem{
+		Update: &types.Update{
+			TableName: &r.tableName,
+			Key: map[string]types.AttributeValue{
+				"id": &types.AttributeValueMemberS{Value: id},
+			},
+			UpdateExpression:          aws.String("SET #deletedAt = :deletedAt, #expiresAt = :expiresAt, #modifiedAt = :modifiedAt ADD #version :one"),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
 	}
+	for attempt := 1; ; attempt++ {
+		// The MAC lookup item, if any, is at index 1
+		transactItems := []types.TransactWriteItem{update}
+		if device.MAC != "" {
+			release, err := r.macRelease(ctx, id, device.MAC)
+			if err != nil {
+				return nil, err
+			}
+			transactItems = append(transactItems, release)
+		}
 
-	// Build the update expression
-	var updateExpr []string
-	exprAttrNames := make(map[string]string)
-	for k := range updates {
-		field := strings.TrimPrefix(k, ":")
-		exprAttrNames["#"+field] = field
-		updateExpr = append(updateExpr, fmt.Sprintf("#%s = %s", field, k))
+		_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append(transactItems, items...),
+		})
+		if err == nil {
+			return &models.DeviceChange{Before: &device, After: &deleted}, nil
+		}
+
+		if isConditionFailure(err, 0) {
+			if expectedVersion != nil {
+				return nil, versionMismatch("DeleteDevice", id, *expectedVersion)
+			}
+			// Deleted concurrently by another request
+			return nil, errors.ErrDomainDeviceNotFound.
+				WithOperation("DeleteDevice").
+				WithLayer("repository").
+				WithContext("device_id", id)
+		}
+		if device.MAC != "" && isConditionFailure(err, 1) && attempt < updateAttempts {
+			// The lookup item changed hands since it was read
+			r.logger.Debug("MAC lookup item changed during delete, retrying",
+				zap.String("device_id", id),
+				zap.Int("attempt", attempt),
+			)
+			continue
+		}
+
+		r.logger.Error("database operation failed",
+			zap.String("operation", "DeleteDevice"),
+			zap.String("table", r.tableName),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to delete device from database", err).
+			WithOperation("DeleteDevice").
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("table", r.tableName).
+			WithContext("attempts", attempt)
+	}
+}
+
+// macRelease builds the transaction item for the MAC lookup item of a device
+// being deleted. The item is deleted when it belongs to the device. A MAC
+// registered to another device, which only happens for MACs registered twice
+// before uniqueness was enforced (cmd/backfill-macs reports those), stays with
+// that device and is only checked, so the delete does not depend on it. Both
+// fail the transaction if the item changed hands since it was read.
+func (r *DeviceRepository) macRelease(ctx context.Context, id string, mac string) (types.TransactWriteItem, error) {
+	mac = models.NormalizeMAC(mac)
+	owner, err := r.GetDeviceIDByMAC(ctx, mac)
+	if err != nil {
+		return types.TransactWriteItem{}, err
 	}
 
-	// Execute the update
-	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	key := map[string]types.AttributeValue{
+		"mac": &types.AttributeValueMemberS{Value: mac},
+	}
+	switch owner {
+	case id:
+		return types.TransactWriteItem{
+			Delete: &types.Delete{
+				TableName:           &r.macTableName,
+				Key:                 key,
+				ConditionExpression: aws.String("deviceId = :deviceId"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":deviceId": &types.AttributeValueMemberS{Value: id},
+				},
+			},
+		}, nil
+	case "":
+		return types.TransactWriteItem{
+			ConditionCheck: &types.ConditionCheck{
+				TableName:           &r.macTableName,
+				Key:                 key,
+				ConditionExpression: aws.String("attribute_not_exists(mac)"),
+			},
+		}, nil
+	default:
+		r.logger.Warn("MAC lookup item belongs to another device, leaving it in place",
+			zap.String("device_id", id),
+			zap.String("device_mac", mac),
+			zap.String("owner_device_id", owner),
+		)
+		return types.TransactWriteItem{
+			ConditionCheck: &types.ConditionCheck{
+				TableName:           &r.macTableName,
+				Key:                 key,
+				ConditionExpression: aws.String("deviceId = :owner"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":owner": &types.AttributeValueMemberS{Value: owner},
+				},
+			},
+		}, nil
+	}
+}
+
+// RestoreDevice clears the tombstone of a soft-deleted device and claims its
+// MAC again. It fails with ErrDomainDeviceNotDeleted when the device is not
+// deleted and with ErrDomainDeviceExists when another device has registered
+// the MAC in the meantime.
+func (r *DeviceRepository) RestoreDevice(ctx context.Context, id string) (*models.Device, error) {
+	r.logger.Debug("restoring device", zap.String("device_id", id))
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: &r.tableName,
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
-		UpdateExpression:          aws.String("SET " + strings.Join(updateExpr, ", ")),
-		ExpressionAttributeNames:  exprAttrNames,
-		ExpressionAttributeValues: updates,
-		ReturnValues:              types.ReturnValueAllNew,
 	})
-
 	if err != nil {
-		r.logger.Error("failed to update device",
+		r.logger.Error("failed to get device for restore",
 			zap.String("device_id", id),
 			zap.Error(err),
 		)
-		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to update device in database", err).
-			WithOperation("UpdateDevice").
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to get device for restore", err).
+			WithOperation("RestoreDevice").
 			WithLayer("repository").
 			WithContext("device_id", id)
 	}
 
-	// Get the updated device
-	updatedResult, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: &r.tableName,
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: id},
+	now := r.clock.Now()
+
+	var device models.Device
+	if result.Item != nil {
+		if err := device.FromMap(result.Item); err != nil {
+			r.logger.Error("failed to unmarshal device",
+				zap.String("device_id", id),
+				zap.Error(err),
+			)
+			return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal device data", err).
+				WithOperation("RestoreDevice").
+				WithLayer("repository").
+				WithContext("device_id", id)
+		}
+	}
+	// TTL removes expired items with a delay; until then they count as purged
+	if result.Item == nil || (device.ExpiresAt != 0 && device.ExpiresAt <= now.Unix()) {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if device.DeletedAt == 0 {
+		return nil, errors.ErrDomainDeviceNotDeleted.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+
+	restored := device
+	restored.DeletedAt = 0
+	restored.ExpiresAt = 0
+	restored.ModifiedAt = now.UnixMilli()
+	restored.Version = device.Version + 1
+
+	condition, names, values := versionCondition(device.Version)
+	names["#deletedAt"] = "deletedAt"
+	names["#expiresAt"] = "expiresAt"
+	names["#modifiedAt"] = "modifiedAt"
+	values[":modifiedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(restored.ModifiedAt, 10)}
+	values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(restored.Version, 10)}
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName: &r.tableName,
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: id},
+				},
+				UpdateExpression:          aws.String("SET #modifiedAt = :modifiedAt, #version = :version REMOVE #deletedAt, #expiresAt"),
+				ConditionExpression:       aws.String("attribute_exists(#deletedAt) AND (" + condition + ")"),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
 		},
+	}
+	if device.MAC != "" {
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: &r.macTableName,
+				Item: map[string]types.AttributeValue{
+					"mac":      &types.AttributeValueMemberS{Value: models.NormalizeMAC(device.MAC)},
+					"deviceId": &types.AttributeValueMemberS{Value: id},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(mac) OR deviceId = :deviceId"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":deviceId": &types.AttributeValueMemberS{Value: id},
+				},
+			},
+		})
+	}
+
+	// The device rejoins its home, which must still exist
+	homeIndex := len(items)
+	items = append(items, r.homeUpdates("", device.HomeID)...)
+
+	if r.outbox != nil {
+		puts, err := r.outboxPuts(r.newEvent(models.EventDeviceRestored, id, nil, &restored))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, puts...)
+	}
+	puts, err := r.historyPuts(ctx, models.EventDeviceRestored, id, &device, &restored)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, puts...)
+
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
 	})
 
 	if err != nil {
-		r.logger.Error("failed to fetch updated device",
-			zap.String("device_id", id),
+		if device.MAC != "" && isConditionFailure(err, 1) {
+			return nil, errors.ErrDomainDeviceExists.
+				WithOperation("RestoreDevice").
+				WithLayer("repository").
+				WithContext("device_id", id).
+				WithContext("device_mac", device.MAC)
+		}
+		if unknown, ok := r.unknownHome(err, homeIndex, "RestoreDevice", id, device.HomeID); ok {
+			return nil, unknown
+		}
+		if isConditionFailure(err, 0) {
+			// Restored or changed by a concurrent request
+			return nil, errors.ErrDomainDeviceNotDeleted.
+				WithOperation("RestoreDevice").
+				WithLayer("repository").
+				WithContext("device_id", id)
+		}
+
+		r.logger.Error("database operation failed",
+			zap.String("operation", "RestoreDevice"),
+			zap.String("table", r.tableName),
 			zap.Error(err),
 		)
-		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to fetch updated device", err).
-			WithOperation("UpdateDevice").
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to restore device in database", err).
+			WithOperation("RestoreDevice").
 			WithLayer("repository").
-			WithContext("device_id", id)
+			WithContext("device_id", id).
+			WithContext("table", r.tableName)
 	}
 
-	var updatedDevice models.Device
-	if err := attributevalue.UnmarshalMap(updatedResult.Item, &updatedDevice); err != nil {
-		r.logger.Error("failed to unmarshal updated device",
-			zap.String("device_id", id),
-			zap.Error(err),
-		)
-		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal updated device", err).
-			WithOperation("UpdateDevice").
-			WithLayer("repository").
-			WithContext("device_id", id)
+	return &restored, nil
+}
+
+// UpdateDevice changes the non-empty name, type and home ID of a device and
+// returns the device before and after the change
+func (r *DeviceRepository) UpdateDevice(ctx context.Context, id string, update models.Device, expectedVersion *int64) (*models.DeviceChange, error) {
+	r.logger.Debug("updating device", zap.String("device_id", id))
+
+	// MAC is deliberately not updatable: it is the key of the device's MAC
+	// lookup item and changing it here would break uniqueness
+	if update.Name == "" && update.Type == "" && update.HomeID == "" { // Nothing to write, return the device as stored
+		current, err := r.GetDevice(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != nil && current.Version != *expectedVersion {
+			return nil, versionMismatch("UpdateDevice", id, *expectedVersion)
+		}
+		return &models.DeviceChange{Before: current, After: current}, nil
 	}
 
-	return &updatedDevice, nil
+	return r.transactUpdate(ctx, "UpdateDevice", id, expectedVersion,
+		func(d *models.Device) {
+			if update.Name != "" {
+				d.Name = update.Name
+			}
+			if update.Type != "" {
+				d.Type = update.Type
+			}
+			if update.HomeID != "" {
+				d.HomeID = update.HomeID
+			}
+		},
+		func(before, after *models.Device) []string {
+			if before.HomeID != after.HomeID {
+				return []string{models.EventDeviceUpdated, models.EventDeviceHomeChanged}
+			}
+			return []string{models.EventDeviceUpdated}
+		},
+	)
 }
 
 func (r *DeviceRepository) CreateDevice(ctx context.Context, device models.Device) (models.Device, error) {
-	now := time.Now().UnixMilli()
-	device.ID = uuid.New().String()
+	now := clock.NowMillis(r.clock)
+	device.ID = r.ids.NewID()
+	device.MAC = models.NormalizeMAC(device.MAC)
 	device.CreatedAt = now
 	device.ModifiedAt = now
+	device.Version = 1
 
-	r.logger.Debug("creating device", zap.String("device_id", device.ID))
+	r.logger.Debug("creating device",
+		zap.String("device_id", device.ID),
+		zap.String("device_mac", device.MAC),
+	)
 
 	item, err := attributevalue.MarshalMap(device)
 	if err != nil {
@@ -306,12 +749,60 @@ func (r *DeviceRepository) CreateDevice(ctx context.Context, device models.Devic
 			WithContext("device_id", device.ID)
 	}
 
-	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(r.tableName),
-		Item:      item,
+	var puts []types.TransactWriteItem
+	created := device
+	if r.outbox != nil {
+		puts, err = r.outboxPuts(r.newEvent(models.EventDeviceCreated, device.ID, nil, &created))
+		if err != nil {
+			return device, err
+		}
+	}
+	historyPuts, err := r.historyPuts(ctx, models.EventDeviceCreated, device.ID, nil, &created)
+	if err != nil {
+		return device, err
+	}
+	puts = append(puts, historyPuts...)
+
+	// The device and its MAC lookup item are written atomically; the lookup
+	// put fails when the MAC is already registered to another device and the
+	// home update (index 2) when the home does not exist
+	homeUpdates := r.homeUpdates("", device.HomeID)
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append(append([]types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(r.tableName),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(r.macTableName),
+					Item: map[string]types.AttributeValue{
+						"mac":      &types.AttributeValueMemberS{Value: device.MAC},
+						"deviceId": &types.AttributeValueMemberS{Value: device.ID},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(mac)"),
+				},
+			},
+		}, homeUpdates...), puts...),
 	})
 
 	if err != nil {
+		if isMACConflict(err) {
+			r.logger.Warn("device with MAC already exists",
+				zap.String("device_mac", device.MAC),
+			)
+			return device, errors.ErrDomainDeviceExists.
+				WithOperation("CreateDevice").
+				WithLayer("repository").
+				WithContext("device_mac", device.MAC)
+		}
+		if unknown, ok := r.unknownHome(err, 2, "CreateDevice", device.ID, device.HomeID); ok {
+			return device, unknown
+		}
+
 		r.logger.Error("database operation failed",
 			zap.String("operation", "CreateDevice"),
 			zap.String("table", r.tableName),
@@ -328,40 +819,187 @@ func (r *DeviceRepository) CreateDevice(ctx context.Context, device models.Devic
 	return device, nil
 }
 
-func (r *DeviceRepository) UpdateDeviceHomeID(ctx context.Context, id string, homeID string) error {
+// isMACConflict reports whether a CreateDevice transaction was cancelled
+// because the MAC lookup item (the second transaction item) already exists
+func isMACConflict(err error) bool {
+	return isConditionFailure(err, 1)
+}
+
+// isConditionFailure reports whether a transaction was cancelled because the
+// condition of the item at index failed
+func isConditionFailure(err error, index int) bool {
+	var canceled *types.TransactionCanceledException
+	if !stderrors.As(err, &canceled) {
+		return false
+	}
+	reasons := canceled.CancellationReasons
+	return len(reasons) > index && aws.ToString(reasons[index].Code) == "ConditionalCheckFailed"
+}
+
+// versionCondition builds a condition expression matching items at the given
+// version. Items written before versioning was introduced have no version
+// attribute and are treated as version 0.
+func versionCondition(version int64) (string, map[string]string, map[string]types.AttributeValue) {
+	names := map[string]string{"#version": "version"}
+	values := map[string]types.AttributeValue{
+		":expectedVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+	}
+	if version == 0 {
+		return "attribute_not_exists(#version) OR #version = :expectedVersion", names, values
+	}
+	return "#version = :expectedVersion", names, values
+}
+
+func versionMismatch(operation string, id string, expectedVersion int64) *errors.DomainError {
+	return errors.ErrDomainVersionMismatch.
+		WithOperation(operation).
+		WithLayer("repository").
+		WithContext("device_id", id).
+		WithContext("expected_version", expectedVersion)
+}
+
+// UpdateDeviceHomeID moves a device to another home. An empty homeID
+// unassigns the device from its home.
+func (r *DeviceRepository) UpdateDeviceHomeID(ctx context.Context, id string, homeID string) (*models.DeviceChange, error) {
 	r.logger.Debug("updating device", zap.String("device_id", id))
 
-	// Get current timestamp for ModifiedAt
-	now := time.Now().Unix()
+	return r.transactUpdate(ctx, "UpdateDeviceHomeID", id, nil,
+		func(d *models.Device) { d.HomeID = homeID },
+		func(_, _ *models.Device) []string { return []string{models.EventDeviceHomeChanged} },
+	)
+}
 
-	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: &r.tableName,
-		Key: map[string]types.AttributeValue{
-			"id": &types.AttributeValueMemberS{Value: id}},
-		UpdateExpression: aws.String("SET #homeId = :homeId, #modifiedAt = :modifiedAt"),
-		ExpressionAttributeNames: map[string]string{
-			"#homeId":     "homeId",
-			"#modifiedAt": "modifiedAt",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":homeId":     &types.AttributeValueMemberS{Value: homeID},
-			":modifiedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
-		},
-		ReturnValues: types.ReturnValueAllNew,
-	})
+// transactUpdate applies change to the stored device and records the events
+// of eventTypes, a history entry of the first of them and the device counts
+// of the homes it leaves and joins, in the same transaction. The write is
+// conditioned on the version that was read, so the before and after images in
+// the events, the history and the returned change are exactly what was
+// replaced and written; a concurrent write is retried.
+//
+// Every update goes through here. That costs a read and a transactional
+// write, which DynamoDB bills at twice the write units, where a bare
+// conditional UpdateItem needs a single call; the history entry and, when
+// enabled, the outbox events and home counts cannot be written atomically
+// with the device otherwise.
+func (r *DeviceRepository) transactUpdate(ctx context.Context, operation string, id string, expectedVersion *int64, change func(*models.Device), eventTypes func(before, after *models.Device) []string) (*models.DeviceChange, error) {
+	for attempt := 1; ; attempt++ {
+		before, err := r.GetDevice(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != nil && before.Version != *expectedVersion {
+			return nil, versionMismatch(operation, id, *expectedVersion)
+		}
 
-	if err != nil {
-		r.logger.Error("failed to update device home ID",
+		after := *before
+		change(&after)
+		after.ModifiedAt = clock.NowMillis(r.clock)
+		after.Version = before.Version + 1
+
+		condition, names, values := versionCondition(before.Version)
+		names["#modifiedAt"] = "modifiedAt"
+		values[":modifiedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(after.ModifiedAt, 10)}
+		values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(after.Version, 10)}
+
+		set := []string{"#modifiedAt = :modifiedAt", "#version = :version"}
+		if after.Name != before.Name {
+			names["#name"] = "name"
+			values[":name"] = &types.AttributeValueMemberS{Value: after.Name}
+			set = append(set, "#name = :name")
+		}
+		if after.Type != before.Type {
+			names["#type"] = "type"
+			values[":type"] = &types.AttributeValueMemberS{Value: after.Type}
+			set = append(set, "#type = :type")
+		}
+		var remove []string
+		if after.HomeID != before.HomeID {
+			names["#homeId"] = "homeId"
+			if after.HomeID == "" {
+				// homeId is the GSI key and may not be an empty string
+				remove = append(remove, "#homeId")
+			} else {
+				values[":homeId"] = &types.AttributeValueMemberS{Value: after.HomeID}
+				set = append(set, "#homeId = :homeId")
+			}
+		}
+		updateExpression := "SET " + strings.Join(set, ", ")
+		if len(remove) > 0 {
+			updateExpression += " REMOVE " + strings.Join(remove, ", ")
+		}
+
+		changeTypes := eventTypes(before, &after)
+		var puts []types.TransactWriteItem
+		if r.outbox != nil {
+			var events []models.DeviceEvent
+			for _, eventType := range changeTypes {
+				events = append(events, r.newEvent(eventType, id, before, &after))
+			}
+			puts, err = r.outboxPuts(events...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		historyPuts, err := r.historyPuts(ctx, changeTypes[0], id, before, &after)
+		if err != nil {
+			return nil, err
+		}
+		puts = append(puts, historyPuts...)
+
+		// The update of a home the device joins is at index 1
+		var joined string
+		if after.HomeID != before.HomeID {
+			joined = after.HomeID
+		}
+		items := append(append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: &r.tableName,
+					Key: map[string]types.AttributeValue{
+						"id": &types.AttributeValueMemberS{Value: id},
+					},
+					UpdateExpression:          aws.String(updateExpression),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, r.homeUpdates(before.HomeID, after.HomeID)...), puts...)
+
+		_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		if err == nil {
+			return &models.DeviceChange{Before: before, After: &after}, nil
+		}
+		if unknown, ok := r.unknownHome(err, 1, operation, id, joined); ok {
+			return nil, unknown
+		}
+
+		if isConditionFailure(err, 0) {
+			if expectedVersion != nil {
+				return nil, versionMismatch(operation, id, *expectedVersion)
+			}
+			if attempt < updateAttempts {
+				r.logger.Debug("device changed during update, retrying",
+					zap.String("operation", operation),
+					zap.String("device_id", id),
+					zap.Int("attempt", attempt),
+				)
+				continue
+			}
+		}
+
+		r.logger.Error("database operation failed",
+			zap.String("operation", operation),
+			zap.String("table", r.tableName),
 			zap.String("device_id", id),
-			zap.String("home_id", homeID),
 			zap.Error(err),
 		)
-		return errors.WrapError(errors.ErrorTypeDatabase, "failed to update device home ID", err).
-			WithOperation("UpdateDeviceHomeID").
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to update device in database", err).
+			WithOperation(operation).
 			WithLayer("repository").
 			WithContext("device_id", id).
-			WithContext("home_id", homeID)
+			WithContext("attempts", attempt)
 	}
-
-	return nil
 }
@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/repository/repotest"
+	"example.com/smart-devices/internal/services"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// newLocalClient returns a client for DynamoDB Local and skips the test
+// unless DYNAMODB_TEST_URL is set, e.g.
+//
+//	DYNAMODB_TEST_URL=http://localhost:8000 go test ./internal/repository/
+func newLocalClient(t *testing.T) *dynamodb.Client {
+	t.Helper()
+
+	endpoint := os.Getenv("DYNAMODB_TEST_URL")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_TEST_URL not set; skipping DynamoDB Local conformance tests")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("dummy", "dummy", "")),
+	)
+	if err != nil {
+		t.Fatalf("Failed to load AWS config: %v", err)
+	}
+	return dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+}
+
+// TestDeviceRepository_Conformance runs the repository conformance suite
+// against DynamoDB Local, plain, with the transactional outbox and with
+// history. With the outbox or history it also checks what the writes recorded.
+func TestDeviceRepository_Conformance(t *testing.T) {
+	client := newLocalClient(t)
+
+	tests := []struct {
+		name    string
+		outbox  bool
+		history bool
+	}{
+		{name: "Plain"},
+		{name: "Outbox", outbox: true},
+		{name: "History", history: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRepo := func(t *testing.T) (*DeviceRepository, string) {
+				suffix := uuid.New().String()[:8]
+				tableName := "devices-test-" + suffix
+				macTableName := "device-macs-test-" + suffix
+				createTestTables(t, client, tableName, macTableName)
+
+				var opts []DeviceRepositoryOption
+				var extraTableName string
+				if tt.outbox {
+					extraTableName = "outbox-test-" + suffix
+					createOutboxTable(t, client, extraTableName)
+					opts = append(opts, WithOutbox(extraTableName, time.Hour))
+				}
+				if tt.history {
+					extraTableName = "history-test-" + suffix
+					createHistoryTable(t, client, extraTableName)
+					opts = append(opts, WithHistory(extraTableName))
+				}
+				return NewDeviceRepository(client, tableName, macTableName, clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop(), opts...), extraTableName
+			}
+
+			repotest.RunRepositoryConformance(t, func() services.DeviceRepository {
+				repo, _ := newRepo(t)
+				return repo
+			})
+
+			if tt.outbox {
+				repo, outboxTableName := newRepo(t)
+				testOutboxEntries(t, client, repo, outboxTableName)
+			}
+			if tt.history {
+				repo, historyTableName := newRepo(t)
+				testHistoryEntries(t, client, repo, historyTableName)
+			}
+		})
+	}
+}
+
+// testOutboxEntries checks that create, update and delete each recorded
+// their events as pending outbox entries
+func testOutboxEntries(t *testing.T, client *dynamodb.Client, repo *DeviceRepository, outboxTableName string) {
+	ctx := context.Background()
+
+	device, err := repo.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Outbox", Type: "light", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	if _, err := repo.UpdateDevice(ctx, device.ID, models.Device{HomeID: "home-2"}, nil); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	if _, err := repo.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+
+	scan, err := client.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(outboxTableName)})
+	if err != nil {
+		t.Fatalf("Failed to scan outbox: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, item := range scan.Items {
+		var entry models.OutboxEntry
+		if err := attributevalue.UnmarshalMap(item, &entry); err != nil {
+			t.Fatalf("Failed to unmarshal outbox entry: %v", err)
+		}
+		if entry.DeviceID != device.ID || entry.Status != models.OutboxStatusPending {
+			t.Errorf("Expected pending entry for %s, got %+v", device.ID, entry)
+		}
+		counts[entry.EventType]++
+	}
+	want := map[string]int{
+		models.EventDeviceCreated:     1,
+		models.EventDeviceUpdated:     1,
+		models.EventDeviceHomeChanged: 1,
+		models.EventDeviceDeleted:     1,
+	}
+	for eventType, count := range want {
+		if counts[eventType] != count {
+			t.Errorf("Expected %d %s entries, got %v", count, eventType, counts)
+		}
+	}
+}
+
+// testHistoryEntries checks that every write recorded one history entry with
+// the fields it changed, attributed to the actor in the context
+func testHistoryEntries(t *testing.T, client *dynamodb.Client, repo *DeviceRepository, historyTableName string) {
+	ctx := audit.WithActor(context.Background(), audit.Actor{ID: "user-1", Source: models.SourceHTTP})
+
+	device, err := repo.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "History", Type: "light", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	if _, err := repo.UpdateDevice(ctx, device.ID, models.Device{Name: "Renamed"}, nil); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	if _, err := repo.UpdateDeviceHomeID(ctx, device.ID, "home-2"); err != nil {
+		t.Fatalf("Failed to move device: %v", err)
+	}
+	if _, err := repo.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+	if _, err := repo.RestoreDevice(ctx, device.ID); err != nil {
+		t.Fatalf("Failed to restore device: %v", err)
+	}
+
+	page, err := NewHistoryRepository(client, historyTableName, zap.NewNop()).GetHistory(ctx, device.ID, 10, "")
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+
+	// Entries of the same millisecond are ordered by ID, so match them by type
+	want := map[string]int{
+		models.EventDeviceCreated:     4,
+		models.EventDeviceUpdated:     1,
+		models.EventDeviceHomeChanged: 1,
+		models.EventDeviceDeleted:     0,
+		models.EventDeviceRestored:    0,
+	}
+	if len(page.Items) != len(want) {
+		t.Fatalf("Expected %d history entries, got %+v", len(want), page.Items)
+	}
+	for _, entry := range page.Items {
+		changes, ok := want[entry.Type]
+		if !ok || len(entry.Changes) != changes || entry.Actor != "user-1" || entry.Source != models.SourceHTTP {
+			t.Errorf("Expected %s entry with %d changes by user-1, got %+v", entry.Type, changes, entry)
+		}
+		delete(want, entry.Type)
+	}
+}
+
+// createHistoryTable creates a history table and deletes it when the test
+// finishes
+func createHistoryTable(t *testing.T, client *dynamodb.Client, tableName string) {
+	t.Helper()
+
+	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("deviceId"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("entryKey"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("deviceId"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("entryKey"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create table %s: %v", tableName, err)
+	}
+	t.Cleanup(func() {
+		if _, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)}); err != nil {
+			t.Logf("Failed to delete table %s: %v", tableName, err)
+		}
+	})
+}
+
+// createOutboxTable creates an outbox table and deletes it when the test
+// finishes
+func createOutboxTable(t *testing.T, client *dynamodb.Client, tableName string) {
+	t.Helper()
+
+	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create table %s: %v", tableName, err)
+	}
+	t.Cleanup(func() {
+		if _, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)}); err != nil {
+			t.Logf("Failed to delete table %s: %v", tableName, err)
+		}
+	})
+}
+
+// createTestTables creates the devices and MAC tables with the same schema as
+// serverless.yml and deletes them when the test finishes
+func createTestTables(t *testing.T, client *dynamodb.Client, tableName, macTableName string) {
+	t.Helper()
+	ctx := context.Background()
+
+	tables := []*dynamodb.CreateTableInput{
+		{
+			TableName: aws.String(tableName),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("homeId"), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			},
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+				{
+					IndexName: aws.String(homeIDIndexName),
+					KeySchema: []types.KeySchemaElement{
+						{AttributeName: aws.String("homeId"), KeyType: types.KeyTypeHash},
+					},
+					Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				},
+			},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+		{
+			TableName: aws.String(macTableName),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("mac"), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("mac"), KeyType: types.KeyTypeHash},
+			},
+			BillingMode: types.BillingModePayPerRequest,
+		},
+	}
+
+	for _, input := range tables {
+		if _, err := client.CreateTable(ctx, input); err != nil {
+			t.Fatalf("Failed to create table %s: %v", aws.ToString(input.TableName), err)
+		}
+		name := input.TableName
+		t.Cleanup(func() {
+			if _, err := client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: name}); err != nil {
+				t.Logf("Failed to delete table %s: %v", aws.ToString(name), err)
+			}
+		})
+	}
+}
+
+// TestDeviceRepository_DeleteDuplicateMAC checks that a device whose MAC was
+// registered twice before uniqueness was enforced can still be deleted, and
+// that the MAC stays with the device its lookup item names
+func TestDeviceRepository_DeleteDuplicateMAC(t *testing.T) {
+	client := newLocalClient(t)
+	ctx := context.Background()
+
+	suffix := uuid.New().String()[:8]
+	tableName := "devices-test-" + suffix
+	macTableName := "device-macs-test-" + suffix
+	createTestTables(t, client, tableName, macTableName)
+	repo := NewDeviceRepository(client, tableName, macTableName, clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop())
+
+	device, err := repo.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Duplicate", Type: "light", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	// Hand the lookup item to the legacy device sharing the MAC
+	owner := uuid.New().String()
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(macTableName),
+		Item: map[string]types.AttributeValue{
+			"mac":      &types.AttributeValueMemberS{Value: device.MAC},
+			"deviceId": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to reassign MAC lookup item: %v", err)
+	}
+
+	if _, err := repo.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("Expected the delete to succeed, got %v", err)
+	}
+	got, err := repo.GetDeviceIDByMAC(ctx, device.MAC)
+	if err != nil {
+		t.Fatalf("Failed to look up MAC: %v", err)
+	}
+	if got != owner {
+		t.Errorf("Expected the MAC to stay with %s, got %q", owner, got)
+	}
+}
+
+// TestIsConditionFailure checks that transaction cancellations are attributed
+// to the right item, which is how a taken MAC lookup item (item 1 of
+// CreateDevice and DeleteDevice) is told apart from a device conflict (item 0)
+func TestIsConditionFailure(t *testing.T) {
+	reason := func(code string) types.CancellationReason {
+		return types.CancellationReason{Code: aws.String(code)}
+	}
+	macTaken := &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{reason("None"), reason("ConditionalCheckFailed")},
+	}
+	deviceExists := &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{reason("ConditionalCheckFailed"), reason("None")},
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		index   int
+		matches bool
+	}{
+		{name: "MAC item failed", err: macTaken, index: 1, matches: true},
+		{name: "device item succeeded", err: macTaken, index: 0, matches: false},
+		{name: "device item failed", err: deviceExists, index: 0, matches: true},
+		{name: "MAC item succeeded", err: deviceExists, index: 1, matches: false},
+		{name: "wrapped cancellation", err: fmt.Errorf("transact: %w", macTaken), index: 1, matches: true},
+		{name: "index out of range", err: macTaken, index: 2, matches: false},
+		{name: "not a cancellation", err: &types.ConditionalCheckFailedException{}, index: 0, matches: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConditionFailure(tt.err, tt.index); got != tt.matches {
+				t.Errorf("Expected %v, got %v", tt.matches, got)
+			}
+		})
+	}
+
+	if !isMACConflict(macTaken) || isMACConflict(deviceExists) {
+		t.Error("Expected isMACConflict to match only a failed MAC lookup item")
+	}
+}
@@ -0,0 +1,153 @@
+// Package dryrun provides a services.DeviceRepository that reads from another
+// repository but never writes to it. Writes are checked against the current
+// state, logged and answered as if they had been applied, so a message or
+// request can be rehearsed against production data. CreateDevice checks MAC
+// uniqueness only when the wrapped repository can look MACs up.
+package dryrun
+
+import (
+	"context"
+	stderrors "errors"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+	"go.uber.org/zap"
+)
+
+var _ services.DeviceRepository = (*DeviceRepository)(nil)
+
+type DeviceRepository struct {
+	services.DeviceRepository
+	logger *zap.Logger
+}
+
+// NewDeviceRepository wraps repo; reads are delegated to it unchanged
+func NewDeviceRepository(repo services.DeviceRepository, logger *zap.Logger) *DeviceRepository {
+	return &DeviceRepository{
+		DeviceRepository: repo,
+		logger:           logger,
+	}
+}
+
+// macLookup is implemented by repositories that can tell which device a MAC
+// is registered to
+type macLookup interface {
+	GetDeviceIDByMAC(ctx context.Context, mac string) (string, error)
+}
+
+func (r *DeviceRepository) CreateDevice(ctx context.Context, device models.Device) (models.Device, error) {
+	device.MAC = models.NormalizeMAC(device.MAC)
+
+	lookup, ok := r.DeviceRepository.(macLookup)
+	if !ok {
+		r.logger.Warn("dry run: MAC uniqueness not checked", zap.String("device_mac", device.MAC))
+	} else {
+		owner, err := lookup.GetDeviceIDByMAC(ctx, device.MAC)
+		if err != nil {
+			return device, err
+		}
+		if owner != "" {
+			return device, errors.ErrDomainDeviceExists.
+				WithOperation("CreateDevice").
+				WithLayer("repository").
+				WithContext("device_mac", device.MAC).
+				WithContext("owner_device_id", owner)
+		}
+	}
+
+	r.logger.Info("dry run: would create device",
+		zap.String("device_mac", device.MAC),
+		zap.String("device_name", device.Name),
+		zap.String("home_id", device.HomeID),
+	)
+	return device, nil
+}
+
+func (r *DeviceRepository) UpdateDevice(ctx context.Context, id string, device models.Device, expectedVersion *int64) (*models.DeviceChange, error) {
+	existing, err := r.current(ctx, "UpdateDevice", id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	before := *existing
+
+	if device.Name != "" {
+		existing.Name = device.Name
+	}
+	if device.Type != "" {
+		existing.Type = device.Type
+	}
+	if device.HomeID != "" {
+		existing.HomeID = device.HomeID
+	}
+
+	r.logger.Info("dry run: would update device",
+		zap.String("device_id", id),
+		zap.String("device_name", existing.Name),
+		zap.String("device_type", existing.Type),
+		zap.String("home_id", existing.HomeID),
+	)
+	return &models.DeviceChange{Before: &before, After: existing}, nil
+}
+
+func (r *DeviceRepository) DeleteDevice(ctx context.Context, id string, expectedVersion *int64) (*models.DeviceChange, error) {
+	existing, err := r.current(ctx, "DeleteDevice", id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("dry run: would delete device", zap.String("device_id", id))
+	return &models.DeviceChange{Before: existing, After: existing}, nil
+}
+
+// RestoreDevice cannot see tombstones through the wrapped repository's reads,
+// so it only rejects devices that are not deleted
+func (r *DeviceRepository) RestoreDevice(ctx context.Context, id string) (*models.Device, error) {
+	_, err := r.DeviceRepository.GetDevice(ctx, id)
+	if err == nil {
+		return nil, errors.ErrDomainDeviceNotDeleted.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if !stderrors.Is(err, errors.ErrDomainDeviceNotFound) {
+		return nil, err
+	}
+
+	r.logger.Info("dry run: would restore device", zap.String("device_id", id))
+	return &models.Device{ID: id}, nil
+}
+
+func (r *DeviceRepository) UpdateDeviceHomeID(ctx context.Context, id string, homeID string) (*models.DeviceChange, error) {
+	existing, err := r.current(ctx, "UpdateDeviceHomeID", id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("dry run: would change device home",
+		zap.String("device_id", id),
+		zap.String("old_home_id", existing.HomeID),
+		zap.String("home_id", homeID),
+	)
+	after := *existing
+	after.HomeID = homeID
+	return &models.DeviceChange{Before: existing, After: &after}, nil
+}
+
+// current loads the device a write would apply to and checks its version
+func (r *DeviceRepository) current(ctx context.Context, operation string, id string, expectedVersion *int64) (*models.Device, error) {
+	existing, err := r.DeviceRepository.GetDevice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return nil, errors.ErrDomainVersionMismatch.
+			WithOperation(operation).
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("expected_version", *expectedVersion)
+	}
+
+	return existing, nil
+}
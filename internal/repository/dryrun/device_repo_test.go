@@ -0,0 +1,38 @@
+package dryrun
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/repository/memory"
+	"example.com/smart-devices/pkg/testsupport"
+	"go.uber.org/zap"
+)
+
+func TestDeviceRepository_CreateDevice_ChecksMAC(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	wrapped := memory.NewDeviceRepository(testsupport.NewFakeClock(testsupport.DefaultTime), testsupport.NewSequentialIDGenerator(), logger)
+	repo := NewDeviceRepository(wrapped, logger)
+
+	device := models.Device{MAC: "aa:bb:cc:dd:ee:ff", Name: "Test Device", Type: "sensor", HomeID: "home-1"}
+	if _, err := wrapped.CreateDevice(ctx, device); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	device.MAC = "AA-BB-CC-DD-EE-FF"
+	if _, err := repo.CreateDevice(ctx, device); !stderrors.Is(err, errors.ErrDomainDeviceExists) {
+		t.Errorf("Expected device exists error for a registered MAC, got %v", err)
+	}
+
+	device.MAC = "00:11:22:33:44:55"
+	if _, err := repo.CreateDevice(ctx, device); err != nil {
+		t.Errorf("Expected no error for a free MAC, got %v", err)
+	}
+	if owner, _ := wrapped.GetDeviceIDByMAC(ctx, device.MAC); owner != "" {
+		t.Errorf("Expected the dry run not to register the MAC, got owner %s", owner)
+	}
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// HistoryRepository reads the device history entries DeviceRepository
+// writes with WithHistory. The table is keyed on deviceId (hash) and entryKey
+// (range). entryKey is the zero-padded timestamp
+// followed by the entry ID, so a query in descending order returns the
+// newest entries first.
+type HistoryRepository struct {
+	client    *dynamodb.Client
+	tableName string
+	logger    *zap.Logger
+}
+
+func NewHistoryRepository(client *dynamodb.Client, tableName string, logger *zap.Logger) *HistoryRepository {
+	return &HistoryRepository{
+		client:    client,
+		tableName: tableName,
+		logger:    logger,
+	}
+}
+
+// historyItem adds the range key to a history entry
+type historyItem struct {
+	models.DeviceHistoryEntry
+	EntryKey string `dynamodbav:"entryKey"`
+}
+
+// WithHistory makes every write record a models.DeviceHistoryEntry in
+// tableName, in the same transaction as the write. The entry is built from
+// the device images the transaction replaces and writes, so it can neither
+// be lost nor describe a different change. HistoryRepository reads them.
+func WithHistory(tableName string) DeviceRepositoryOption {
+	return func(r *DeviceRepository) {
+		r.historyTableName = tableName
+	}
+}
+
+// historyPuts builds the history put for a change of the device from before
+// to after, attributed to the actor in ctx; it is empty when history is not
+// enabled
+func (r *DeviceRepository) historyPuts(ctx context.Context, eventType string, id string, before *models.Device, after *models.Device) ([]types.TransactWriteItem, error) {
+	if r.historyTableName == "" {
+		return nil, nil
+	}
+
+	actor := audit.FromContext(ctx)
+	entry := models.DeviceHistoryEntry{
+		DeviceID:  id,
+		ID:        r.ids.NewID(),
+		Type:      eventType,
+		Actor:     actor.ID,
+		Source:    actor.Source,
+		Changes:   models.FieldChanges(before, after),
+		Timestamp: clock.NowMillis(r.clock),
+	}
+
+	item, err := attributevalue.MarshalMap(historyItem{
+		DeviceHistoryEntry: entry,
+		EntryKey:           fmt.Sprintf("%013d#%s", entry.Timestamp, entry.ID),
+	})
+	if err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to marshal history entry", err).
+			WithOperation("HistoryPut").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+
+	return []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				TableName: aws.String(r.historyTableName),
+				Item:      item,
+				// History is append-only: an entry is never overwritten
+				ConditionExpression: aws.String("attribute_not_exists(entryKey)"),
+			},
+		},
+	}, nil
+}
+
+func (r *HistoryRepository) GetHistory(ctx context.Context, deviceID string, limit int32, nextToken string) (*models.DeviceHistoryPage, error) {
+	r.logger.Debug("fetching device history",
+		zap.String("device_id", deviceID),
+		zap.Int32("limit", limit),
+		zap.Bool("has_next_token", nextToken != ""),
+	)
+
+	input := &dynamodb.QueryInput{
+		TableName:              &r.tableName,
+		KeyConditionExpression: aws.String("#deviceId = :deviceId"),
+		ExpressionAttributeNames: map[string]string{
+			"#deviceId": "deviceId",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":deviceId": &types.AttributeValueMemberS{Value: deviceID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(limit)
+	}
+	if nextToken != "" {
+		startKey, err := decodePageToken(nextToken)
+		if err != nil {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetHistory").
+				WithLayer("repository")
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := r.client.Query(ctx, input)
+	if err != nil {
+		r.logger.Error("database operation failed",
+			zap.String("operation", "GetHistory"),
+			zap.String("table", r.tableName),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to query device history", err).
+			WithOperation("GetHistory").
+			WithLayer("repository").
+			WithContext("device_id", deviceID).
+			WithContext("table", r.tableName)
+	}
+
+	entries := make([]models.DeviceHistoryEntry, 0, len(result.Items))
+	for i, item := range result.Items {
+		var entry models.DeviceHistoryEntry
+		if err := attributevalue.UnmarshalMap(item, &entry); err != nil {
+			r.logger.Error("failed to unmarshal history entry",
+				zap.Int("item_index", i),
+				zap.Error(err))
+			// Skip malformed items but continue processing
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	token, err := encodePageToken(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to encode pagination token", err).
+			WithOperation("GetHistory").
+			WithLayer("repository")
+	}
+
+	return &models.DeviceHistoryPage{
+		Items:     entries,
+		NextToken: token,
+	}, nil
+}
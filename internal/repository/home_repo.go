@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+// HomeRepository stores homes in a table keyed on id
+type HomeRepository struct {
+	client    *dynamodb.Client
+	tableName string
+	clock     clock.Clock
+	ids       idgen.IDGenerator
+	logger    *zap.Logger
+}
+
+// NewHomeRepository creates a repository backed by the homes table.
+// Timestamps are taken from clk in Unix milliseconds and new home IDs come
+// from ids.
+func NewHomeRepository(client *dynamodb.Client, tableName string, clk clock.Clock, ids idgen.IDGenerator, logger *zap.Logger) *HomeRepository {
+	return &HomeRepository{
+		client:    client,
+		tableName: tableName,
+		clock:     clk,
+		ids:       ids,
+		logger:    logger,
+	}
+}
+
+func (r *HomeRepository) GetHome(ctx context.Context, id string) (*models.Home, error) {
+	r.logger.Debug("fetching home", zap.String("home_id", id))
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &r.tableName,
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
+	if err != nil {
+		r.logger.Error("database operation failed",
+			zap.String("operation", "GetHome"),
+			zap.String("table", r.tableName),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to get home from database", err).
+			WithOperation("GetHome").
+			WithLayer("repository").
+			WithContext("home_id", id).
+			WithContext("table", r.tableName)
+	}
+
+	if result.Item == nil {
+		return nil, errors.ErrDomainHomeNotFound.
+			WithOperation("GetHome").
+			WithLayer("repository").
+			WithContext("home_id", id)
+	}
+
+	var home models.Home
+	if err := attributevalue.UnmarshalMap(result.Item, &home); err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal home data", err).
+			WithOperation("GetHome").
+			WithLayer("repository").
+			WithContext("home_id", id)
+	}
+
+	return &home, nil
+}
+
+// GetHomes returns one page of homes. Unlike GetDevices an empty table is an
+// empty page rather than an error.
+func (r *HomeRepository) GetHomes(ctx context.Context, limit int32, nextToken string) (*models.HomePage, error) {
+	r.logger.Debug("fetching homes",
+		zap.Int32("limit", limit),
+		zap.Bool("has_next_token", nextToken != ""),
+	)
+
+	input := &dynamodb.ScanInput{
+		TableName: &r.tableName,
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(limit)
+	}
+	if nextToken != "" {
+		startKey, err := decodePageToken(nextToken)
+		if err != nil {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetHomes").
+				WithLayer("repository")
+		}
+		input.ExclusiveStartKey = startKey
+	}
+
+	result, err := r.client.Scan(ctx, input)
+	if err != nil {
+		r.logger.Error("database operation failed",
+			zap.String("operation", "GetHomes"),
+			zap.String("table", r.tableName),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to scan homes from database", err).
+			WithOperation("GetHomes").
+			WithLayer("repository").
+			WithContext("table", r.tableName)
+	}
+
+	homes := make([]models.Home, 0, len(result.Items))
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &homes); err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal homes", err).
+			WithOperation("GetHomes").
+			WithLayer("repository")
+	}
+
+	token, err := encodePageToken(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to encode pagination token", err).
+			WithOperation("GetHomes").
+			WithLayer("repository")
+	}
+
+	return &models.HomePage{
+		Items:     homes,
+		NextToken: token,
+	}, nil
+}
+
+func (r *HomeRepository) CreateHome(ctx context.Context, home models.Home) (models.Home, error) {
+	now := clock.NowMillis(r.clock)
+	home.ID = r.ids.NewID()
+	home.CreatedAt = now
+	home.ModifiedAt = now
+	home.Version = 1
+	home.DeviceCount = 0
+
+	r.logger.Debug("creating home", zap.String("home_id", home.ID))
+
+	item, err := attributevalue.MarshalMap(home)
+	if err != nil {
+		return home, errors.WrapError(errors.ErrorTypeDatabase, "failed to marshal home data", err).
+			WithOperation("CreateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID)
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &r.tableName,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		r.logger.Error("database operation failed",
+			zap.String("operation", "CreateHome"),
+			zap.String("table", r.tableName),
+			zap.String("home_id", home.ID),
+			zap.Error(err),
+		)
+		return home, errors.WrapError(errors.ErrorTypeDatabase, "failed to create home in database", err).
+			WithOperation("CreateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID).
+			WithContext("table", r.tableName)
+	}
+
+	return home, nil
+}
+
+// UpdateHome writes the editable fields of home, provided it still exists at
+// home.Version, and returns the stored home with the version bumped.
+// DeviceCount is left alone: the device repository changes it without
+// bumping the version.
+func (r *HomeRepository) UpdateHome(ctx context.Context, home models.Home) (*models.Home, error) {
+	r.logger.Debug("updating home",
+		zap.String("home_id", home.ID),
+		zap.Int64("version", home.Version),
+	)
+
+	condition, names, values := versionCondition(home.Version)
+	names["#name"] = "name"
+	names["#timezone"] = "timezone"
+	names["#owner"] = "owner"
+	names["#address"] = "address"
+	names["#modifiedAt"] = "modifiedAt"
+	values[":name"] = &types.AttributeValueMemberS{Value: home.Name}
+	values[":timezone"] = &types.AttributeValueMemberS{Value: home.Timezone}
+	values[":owner"] = &types.AttributeValueMemberS{Value: home.Owner}
+	values[":modifiedAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(clock.NowMillis(r.clock), 10)}
+	values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(home.Version+1, 10)}
+
+	set := []string{"#name = :name", "#timezone = :timezone", "#owner = :owner", "#modifiedAt = :modifiedAt", "#version = :version"}
+	updateExpression := "SET " + strings.Join(set, ", ")
+	if home.Address == "" {
+		// address is omitted when empty, as CreateHome writes it
+		updateExpression += " REMOVE #address"
+	} else {
+		values[":address"] = &types.AttributeValueMemberS{Value: home.Address}
+		updateExpression += ", #address = :address"
+	}
+
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &r.tableName,
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: home.ID},
+		},
+		UpdateExpression:                    aws.String(updateExpression),
+		ConditionExpression:                 aws.String("attribute_exists(id) AND (" + condition + ")"),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		if notFound, ok := r.conditionFailure(err, "UpdateHome", home.ID, home.Version); ok {
+			return nil, notFound
+		}
+
+		r.logger.Error("failed to update home",
+			zap.String("home_id", home.ID),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to update home in database", err).
+			WithOperation("UpdateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID)
+	}
+
+	var updated models.Home
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to unmarshal updated home", err).
+			WithOperation("UpdateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID)
+	}
+
+	return &updated, nil
+}
+
+// DeleteHome removes a home that no active device is assigned to. It fails
+// with ErrDomainHomeNotEmpty while its deviceCount is above zero, which the
+// device repository keeps in the same transaction as each assignment. When
+// expectedVersion is non-nil the home is only removed if it is still at that
+// version.
+func (r *HomeRepository) DeleteHome(ctx context.Context, id string, expectedVersion *int64) error {
+	r.logger.Debug("deleting home", zap.String("home_id", id))
+
+	condition := "attribute_exists(id) AND (attribute_not_exists(#deviceCount) OR #deviceCount = :zero)"
+	names := map[string]string{"#deviceCount": "deviceCount"}
+	values := map[string]types.AttributeValue{
+		":zero": &types.AttributeValueMemberN{Value: "0"},
+	}
+	if expectedVersion != nil {
+		versionExpr, versionNames, versionValues := versionCondition(*expectedVersion)
+		condition += " AND (" + versionExpr + ")"
+		for k, v := range versionNames {
+			names[k] = v
+		}
+		for k, v := range versionValues {
+			values[k] = v
+		}
+	}
+
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &r.tableName,
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionFailed) && conditionFailed.Item != nil {
+			var stored models.Home
+			if err := attributevalue.UnmarshalMap(conditionFailed.Item, &stored); err == nil &&
+				(expectedVersion == nil || stored.Version == *expectedVersion) && stored.DeviceCount > 0 {
+				return errors.ErrDomainHomeNotEmpty.
+					WithOperation("DeleteHome").
+					WithLayer("repository").
+					WithContext("home_id", id).
+					WithContext("device_count", stored.DeviceCount)
+			}
+		}
+		if condErr, ok := r.conditionFailure(err, "DeleteHome", id, aws.ToInt64(expectedVersion)); ok {
+			return condErr
+		}
+
+		r.logger.Error("failed to delete home",
+			zap.String("home_id", id),
+			zap.Error(err),
+		)
+		return errors.WrapError(errors.ErrorTypeDatabase, "failed to delete home from database", err).
+			WithOperation("DeleteHome").
+			WithLayer("repository").
+			WithContext("home_id", id)
+	}
+
+	return nil
+}
+
+// WithHomes makes every write that assigns a device to a home, or takes it
+// out of one, update the deviceCount of the homes in tableName in the same
+// transaction. The update of the home a device joins is conditioned on the
+// home existing, so a device can never be assigned to an unknown home and a
+// home with devices can never be deleted (see HomeRepository.DeleteHome).
+func WithHomes(tableName string) DeviceRepositoryOption {
+	return func(r *DeviceRepository) {
+		r.homesTableName = tableName
+	}
+}
+
+// homeUpdates builds the deviceCount updates for a device moving from one
+// home to another; either may be empty. The update of to, when there is one,
+// comes first so callers can tell an unknown home by its index. It is empty
+// when homes are not enabled or the home does not change.
+func (r *DeviceRepository) homeUpdates(from string, to string) []types.TransactWriteItem {
+	if r.homesTableName == "" || from == to {
+		return nil
+	}
+
+	update := func(homeID string, delta string) types.TransactWriteItem {
+		return types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(r.homesTableName),
+				Key: map[string]types.AttributeValue{
+					"id": &types.AttributeValueMemberS{Value: homeID},
+				},
+				UpdateExpression: aws.String("ADD #deviceCount :delta"),
+				// Without the condition ADD would create a partial home
+				ConditionExpression:       aws.String("attribute_exists(id)"),
+				ExpressionAttributeNames:  map[string]string{"#deviceCount": "deviceCount"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{":delta": &types.AttributeValueMemberN{Value: delta}},
+			},
+		}
+	}
+
+	var items []types.TransactWriteItem
+	if to != "" {
+		items = append(items, update(to, "1"))
+	}
+	if from != "" {
+		items = append(items, update(from, "-1"))
+	}
+	return items
+}
+
+// unknownHome reports whether a transaction was cancelled because the home a
+// device joins, whose update homeUpdates put at index, does not exist
+func (r *DeviceRepository) unknownHome(err error, index int, operation string, id string, homeID string) (*errors.DomainError, bool) {
+	if r.homesTableName == "" || homeID == "" || !isConditionFailure(err, index) {
+		return nil, false
+	}
+	return errors.ErrDomainUnknownHome.
+		WithOperation(operation).
+		WithLayer("repository").
+		WithContext("device_id", id).
+		WithContext("home_id", homeID), true
+}
+
+// conditionFailure maps a failed write condition to ErrDomainHomeNotFound
+// when the home is missing and to ErrDomainHomeVersionMismatch otherwise
+func (r *HomeRepository) conditionFailure(err error, operation string, id string, expectedVersion int64) (*errors.DomainError, bool) {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !stderrors.As(err, &conditionFailed) {
+		return nil, false
+	}
+	// The old item is only returned when it exists
+	if conditionFailed.Item == nil {
+		return errors.ErrDomainHomeNotFound.
+			WithOperation(operation).
+			WithLayer("repository").
+			WithContext("home_id", id), true
+	}
+	return errors.ErrDomainHomeVersionMismatch.
+		WithOperation(operation).
+		WithLayer("repository").
+		WithContext("home_id", id).
+		WithContext("expected_version", expectedVersion), true
+}
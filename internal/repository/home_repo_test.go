@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"testing"
+
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/repository/repotest"
+	"example.com/smart-devices/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// TestHomeRepository_Conformance runs the home conformance suite against
+// DynamoDB Local. It is skipped unless DYNAMODB_TEST_URL is set.
+func TestHomeRepository_Conformance(t *testing.T) {
+	client := newLocalClient(t)
+
+	repotest.RunHomeRepositoryConformance(t, func() services.HomeRepository {
+		tableName := "homes-test-" + uuid.New().String()[:8]
+
+		// The homes table is keyed on id like the outbox table
+		createOutboxTable(t, client, tableName)
+
+		return NewHomeRepository(client, tableName, clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop())
+	})
+}
+
+// TestHomeReference_Conformance runs the home reference suite against
+// DynamoDB Local with a device repository keeping home device counts
+func TestHomeReference_Conformance(t *testing.T) {
+	client := newLocalClient(t)
+
+	repotest.RunHomeReferenceConformance(t, func() (services.DeviceRepository, services.HomeRepository) {
+		suffix := uuid.New().String()[:8]
+		tableName := "devices-test-" + suffix
+		macTableName := "device-macs-test-" + suffix
+		homesTableName := "homes-test-" + suffix
+		createTestTables(t, client, tableName, macTableName)
+		createOutboxTable(t, client, homesTableName)
+
+		devices := NewDeviceRepository(client, tableName, macTableName, clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop(),
+			WithHomes(homesTableName))
+		return devices, NewHomeRepository(client, homesTableName, clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop())
+	})
+}
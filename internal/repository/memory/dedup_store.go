@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/services"
+)
+
+var _ services.MessageDedupStore = (*DedupStore)(nil)
+
+type dedupEntry struct {
+	done      bool
+	expiresAt time.Time
+}
+
+// DedupStore is the in-memory services.MessageDedupStore. Expired entries are
+// ignored like DynamoDB items past their TTL.
+type DedupStore struct {
+	mu        sync.Mutex
+	entries   map[string]dedupEntry
+	clock     clock.Clock
+	lease     time.Duration
+	retention time.Duration
+}
+
+func NewDedupStore(clk clock.Clock, lease time.Duration, retention time.Duration) *DedupStore {
+	return &DedupStore{
+		entries:   make(map[string]dedupEntry),
+		clock:     clk,
+		lease:     lease,
+		retention: retention,
+	}
+}
+
+func (s *DedupStore) Claim(_ context.Context, key string) (services.ClaimStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if entry, ok := s.entries[key]; ok && !entry.expiresAt.Before(now) {
+		if entry.done {
+			return services.ClaimDone, nil
+		}
+		return services.ClaimInFlight, nil
+	}
+
+	s.entries[key] = dedupEntry{expiresAt: now.Add(s.lease)}
+	return services.ClaimAcquired, nil
+}
+
+func (s *DedupStore) Complete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = dedupEntry{done: true, expiresAt: s.clock.Now().Add(s.retention)}
+	return nil
+}
+
+func (s *DedupStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && !entry.done {
+		delete(s.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/pkg/testsupport"
+)
+
+func TestDedupStore(t *testing.T) {
+	ctx := context.Background()
+	clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+	store := NewDedupStore(clock, time.Minute, time.Hour)
+
+	claim := func(want services.ClaimStatus) {
+		t.Helper()
+		got, err := store.Claim(ctx, "m-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got != want {
+			t.Fatalf("Expected claim status %v, got %v", want, got)
+		}
+	}
+
+	claim(services.ClaimAcquired)
+	// An in-flight claim blocks other deliveries until its lease expires
+	claim(services.ClaimInFlight)
+	clock.Advance(2 * time.Minute)
+	claim(services.ClaimAcquired)
+
+	// Releasing lets the next delivery retry
+	if err := store.Release(ctx, "m-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	claim(services.ClaimAcquired)
+
+	// A completed message is remembered for the retention period and
+	// cannot be released
+	if err := store.Complete(ctx, "m-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Release(ctx, "m-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	claim(services.ClaimDone)
+	clock.Advance(30 * time.Minute)
+	claim(services.ClaimDone)
+	clock.Advance(31 * time.Minute)
+	claim(services.ClaimAcquired)
+}
@@ -0,0 +1,445 @@
+// Package memory provides an in-memory implementation of
+// services.DeviceRepository for tests and local development. It mirrors the
+// DynamoDB repository's domain errors, timestamps and versioning.
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+	"go.uber.org/zap"
+)
+
+var _ services.DeviceRepository = (*DeviceRepository)(nil)
+
+// defaultTombstoneRetention matches the DynamoDB repository's default
+const defaultTombstoneRetention = 30 * 24 * time.Hour
+
+// DeviceRepository stores devices in a map guarded by a mutex. Listings are
+// ordered by device ID so pagination is stable. Deleted devices stay in the
+// map as tombstones until their retention has passed.
+type DeviceRepository struct {
+	mu        sync.RWMutex
+	devices   map[string]models.Device
+	macs      map[string]string // normalized MAC -> device ID
+	clock     clock.Clock
+	ids       idgen.IDGenerator
+	retention time.Duration
+	history   *HistoryRepository
+	homes     *HomeRepository
+	logger    *zap.Logger
+}
+
+// Option configures optional DeviceRepository behavior
+type Option func(*DeviceRepository)
+
+// WithTombstoneRetention sets how long a deleted device can be restored
+func WithTombstoneRetention(retention time.Duration) Option {
+	return func(r *DeviceRepository) {
+		r.retention = retention
+	}
+}
+
+// WithHistory makes every write append its history entry to h while the
+// change is stored, like the DynamoDB repository's WithHistory
+func WithHistory(h *HistoryRepository) Option {
+	return func(r *DeviceRepository) {
+		r.history = h
+	}
+}
+
+// WithHomes makes every write that assigns a device to a home, or takes it
+// out of one, update the homes' device counts in h while the change is
+// stored, like the DynamoDB repository's WithHomes. Assigning a device to a
+// home that does not exist fails with ErrDomainUnknownHome.
+func WithHomes(h *HomeRepository) Option {
+	return func(r *DeviceRepository) {
+		r.homes = h
+	}
+}
+
+func NewDeviceRepository(clk clock.Clock, ids idgen.IDGenerator, logger *zap.Logger, opts ...Option) *DeviceRepository {
+	r := &DeviceRepository{
+		devices:   make(map[string]models.Device),
+		macs:      make(map[string]string),
+		clock:     clk,
+		ids:       ids,
+		retention: defaultTombstoneRetention,
+		logger:    logger,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *DeviceRepository) GetDevice(_ context.Context, id string) (*models.Device, error) {
+	r.logger.Debug("fetching device", zap.String("device_id", id))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	device, ok := r.devices[id]
+	if !ok || device.DeletedAt != 0 {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("GetDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+
+	return &device, nil
+}
+
+func (r *DeviceRepository) GetDevices(_ context.Context, limit int32, nextToken string) (*models.DevicePage, error) {
+	r.logger.Debug("fetching devices", zap.Int32("limit", limit))
+
+	var after string
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil || len(raw) == 0 {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetDevices").
+				WithLayer("repository")
+		}
+		after = string(raw)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := r.sortedIDs(func(models.Device) bool { return true })
+	if len(ids) == 0 && nextToken == "" {
+		return nil, errors.ErrDomainNoDevicesFound.
+			WithOperation("GetDevices").
+			WithLayer("repository")
+	}
+
+	start := sort.SearchStrings(ids, after)
+	if start < len(ids) && ids[start] == after {
+		start++
+	}
+
+	end := len(ids)
+	if limit > 0 && start+int(limit) < end {
+		end = start + int(limit)
+	}
+
+	page := &models.DevicePage{
+		Items: make([]models.Device, 0, end-start),
+	}
+	for _, id := range ids[start:end] {
+		page.Items = append(page.Items, r.devices[id])
+	}
+	// Like DynamoDB, a full page yields a token even if nothing follows it
+	if limit > 0 && end-start == int(limit) {
+		page.NextToken = base64.RawURLEncoding.EncodeToString([]byte(ids[end-1]))
+	}
+
+	return page, nil
+}
+
+func (r *DeviceRepository) GetDevicesByHome(_ context.Context, homeID string) ([]models.Device, error) {
+	r.logger.Debug("fetching devices by home", zap.String("home_id", homeID))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := r.sortedIDs(func(d models.Device) bool { return d.HomeID == homeID })
+	if len(ids) == 0 {
+		return nil, errors.ErrDomainNoDevicesFound.
+			WithOperation("GetDevicesByHome").
+			WithLayer("repository").
+			WithContext("home_id", homeID)
+	}
+
+	devices := make([]models.Device, 0, len(ids))
+	for _, id := range ids {
+		devices = append(devices, r.devices[id])
+	}
+
+	return devices, nil
+}
+
+// GetDeviceIDByMAC returns the ID of the device the MAC is registered to, or
+// "" when no device holds it
+func (r *DeviceRepository) GetDeviceIDByMAC(_ context.Context, mac string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.macs[models.NormalizeMAC(mac)], nil
+}
+
+func (r *DeviceRepository) CreateDevice(ctx context.Context, device models.Device) (models.Device, error) {
+	now := clock.NowMillis(r.clock)
+	device.ID = r.ids.NewID()
+	device.MAC = models.NormalizeMAC(device.MAC)
+	device.CreatedAt = now
+	device.ModifiedAt = now
+	device.Version = 1
+
+	r.logger.Debug("creating device",
+		zap.String("device_id", device.ID),
+		zap.String("device_mac", device.MAC),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, taken := r.macs[device.MAC]; taken {
+		return device, errors.ErrDomainDeviceExists.
+			WithOperation("CreateDevice").
+			WithLayer("repository").
+			WithContext("device_mac", device.MAC)
+	}
+	if _, taken := r.devices[device.ID]; taken {
+		return device, errors.WrapError(errors.ErrorTypeDatabase, "failed to create device in database", nil).
+			WithOperation("CreateDevice").
+			WithLayer("repository").
+			WithContext("device_id", device.ID)
+	}
+
+	if err := r.moveHome("CreateDevice", device.ID, "", device.HomeID); err != nil {
+		return device, err
+	}
+	if err := r.appendHistory(ctx, models.EventDeviceCreated, nil, device); err != nil {
+		return device, err
+	}
+	r.devices[device.ID] = device
+	r.macs[device.MAC] = device.ID
+
+	return device, nil
+}
+
+func (r *DeviceRepository) UpdateDevice(ctx context.Context, id string, update models.Device, expectedVersion *int64) (*models.DeviceChange, error) {
+	r.logger.Debug("updating device", zap.String("device_id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, ok := r.devices[id]
+	if !ok || device.DeletedAt != 0 {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("UpdateDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if expectedVersion != nil && device.Version != *expectedVersion {
+		return nil, versionMismatch("UpdateDevice", id, *expectedVersion)
+	}
+
+	// MAC is not updatable, matching the DynamoDB repository
+	if update.Type == "" && update.Name == "" && update.HomeID == "" {
+		return &models.DeviceChange{Before: &device, After: &device}, nil
+	}
+
+	before := device
+	if update.Type != "" {
+		device.Type = update.Type
+	}
+	if update.Name != "" {
+		device.Name = update.Name
+	}
+	if update.HomeID != "" {
+		device.HomeID = update.HomeID
+	}
+	device.ModifiedAt = clock.NowMillis(r.clock)
+	device.Version++
+
+	if err := r.moveHome("UpdateDevice", id, before.HomeID, device.HomeID); err != nil {
+		return nil, err
+	}
+	if err := r.appendHistory(ctx, models.EventDeviceUpdated, &before, device); err != nil {
+		return nil, err
+	}
+	r.devices[id] = device
+
+	return &models.DeviceChange{Before: &before, After: &device}, nil
+}
+
+// DeleteDevice marks the device with a tombstone and releases its MAC, like
+// the DynamoDB repository. Expired tombstones are purged on every delete,
+// standing in for DynamoDB TTL.
+func (r *DeviceRepository) DeleteDevice(ctx context.Context, id string, expectedVersion *int64) (*models.DeviceChange, error) {
+	r.logger.Debug("deleting device", zap.String("device_id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	r.purgeExpired(now)
+
+	device, ok := r.devices[id]
+	if !ok || device.DeletedAt != 0 {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("DeleteDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if expectedVersion != nil && device.Version != *expectedVersion {
+		return nil, versionMismatch("DeleteDevice", id, *expectedVersion)
+	}
+
+	before := device
+	device.DeletedAt = now.UnixMilli()
+	device.ExpiresAt = now.Add(r.retention).Unix()
+	device.ModifiedAt = now.UnixMilli()
+	device.Version++
+	if err := r.moveHome("DeleteDevice", id, device.HomeID, ""); err != nil {
+		return nil, err
+	}
+	if err := r.appendHistory(ctx, models.EventDeviceDeleted, &before, device); err != nil {
+		return nil, err
+	}
+	r.devices[id] = device
+	if r.macs[device.MAC] == id {
+		delete(r.macs, device.MAC)
+	}
+
+	return &models.DeviceChange{Before: &before, After: &device}, nil
+}
+
+func (r *DeviceRepository) RestoreDevice(ctx context.Context, id string) (*models.Device, error) {
+	r.logger.Debug("restoring device", zap.String("device_id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	r.purgeExpired(now)
+
+	device, ok := r.devices[id]
+	if !ok {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if device.DeletedAt == 0 {
+		return nil, errors.ErrDomainDeviceNotDeleted.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id)
+	}
+	if owner, taken := r.macs[device.MAC]; taken && owner != id {
+		return nil, errors.ErrDomainDeviceExists.
+			WithOperation("RestoreDevice").
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("device_mac", device.MAC)
+	}
+
+	before := device
+	device.DeletedAt = 0
+	device.ExpiresAt = 0
+	device.ModifiedAt = now.UnixMilli()
+	device.Version++
+	if err := r.moveHome("RestoreDevice", id, "", device.HomeID); err != nil {
+		return nil, err
+	}
+	if err := r.appendHistory(ctx, models.EventDeviceRestored, &before, device); err != nil {
+		return nil, err
+	}
+	r.devices[id] = device
+	r.macs[device.MAC] = id
+
+	return &device, nil
+}
+
+func (r *DeviceRepository) UpdateDeviceHomeID(ctx context.Context, id string, homeID string) (*models.DeviceChange, error) {
+	r.logger.Debug("updating device", zap.String("device_id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, ok := r.devices[id]
+	if !ok || device.DeletedAt != 0 {
+		return nil, errors.ErrDomainDeviceNotFound.
+			WithOperation("UpdateDeviceHomeID").
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("home_id", homeID)
+	}
+
+	before := device
+	device.HomeID = homeID
+	device.ModifiedAt = clock.NowMillis(r.clock)
+	device.Version++
+	if err := r.moveHome("UpdateDeviceHomeID", id, before.HomeID, device.HomeID); err != nil {
+		return nil, err
+	}
+	if err := r.appendHistory(ctx, models.EventDeviceHomeChanged, &before, device); err != nil {
+		return nil, err
+	}
+	r.devices[id] = device
+
+	return &models.DeviceChange{Before: &before, After: &device}, nil
+}
+
+// moveHome updates the device counts of the homes a device leaves and joins
+// when homes are enabled. Callers hold r.mu for writing.
+func (r *DeviceRepository) moveHome(operation string, id string, from string, to string) error {
+	if r.homes == nil {
+		return nil
+	}
+	return r.homes.moveDevice(operation, id, from, to)
+}
+
+// appendHistory records the change of a device from before to after,
+// attributed to the actor in ctx, when history is enabled. Callers hold r.mu
+// for writing so the entry and the change are stored together.
+func (r *DeviceRepository) appendHistory(ctx context.Context, eventType string, before *models.Device, after models.Device) error {
+	if r.history == nil {
+		return nil
+	}
+
+	actor := audit.FromContext(ctx)
+	return r.history.AppendHistory(ctx, models.DeviceHistoryEntry{
+		DeviceID:  after.ID,
+		ID:        r.ids.NewID(),
+		Type:      eventType,
+		Actor:     actor.ID,
+		Source:    actor.Source,
+		Changes:   models.FieldChanges(before, &after),
+		Timestamp: clock.NowMillis(r.clock),
+	})
+}
+
+// sortedIDs returns the IDs of devices matching keep in ascending order,
+// skipping tombstones. Callers must hold r.mu.
+func (r *DeviceRepository) sortedIDs(keep func(models.Device) bool) []string {
+	ids := make([]string, 0, len(r.devices))
+	for id, device := range r.devices {
+		if device.DeletedAt == 0 && keep(device) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// purgeExpired removes tombstones whose retention has passed. Callers must
+// hold r.mu for writing.
+func (r *DeviceRepository) purgeExpired(now time.Time) {
+	for id, device := range r.devices {
+		if device.DeletedAt != 0 && device.ExpiresAt <= now.Unix() {
+			delete(r.devices, id)
+		}
+	}
+}
+
+func versionMismatch(operation string, id string, expectedVersion int64) *errors.DomainError {
+	return errors.ErrDomainVersionMismatch.
+		WithOperation(operation).
+		WithLayer("repository").
+		WithContext("device_id", id).
+		WithContext("expected_version", expectedVersion)
+}
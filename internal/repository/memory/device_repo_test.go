@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/repository/repotest"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/pkg/testsupport"
+	"go.uber.org/zap"
+)
+
+func TestDeviceRepository_Conformance(t *testing.T) {
+	repotest.RunRepositoryConformance(t, func() services.DeviceRepository {
+		clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+		clock.Step = time.Millisecond
+		return NewDeviceRepository(clock, testsupport.NewSequentialIDGenerator(), zap.NewNop())
+	})
+}
+
+func TestDeviceRepository_PurgesExpiredTombstones(t *testing.T) {
+	ctx := context.Background()
+	clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+	repo := NewDeviceRepository(clock, testsupport.NewSequentialIDGenerator(), zap.NewNop(), WithTombstoneRetention(time.Hour))
+
+	device, err := repo.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Sensor", Type: "sensor"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+
+	if _, err := repo.RestoreDevice(ctx, device.ID); !stderrors.Is(err, errors.ErrDomainDeviceNotFound) {
+		t.Fatalf("Expected purged device to be not found, got %v", err)
+	}
+	if _, ok := repo.devices[device.ID]; ok {
+		t.Error("Expected tombstone to be removed")
+	}
+}
+
+func TestDeviceRepository_RecordsHistory(t *testing.T) {
+	history := NewHistoryRepository()
+	repo := NewDeviceRepository(testsupport.NewFakeClock(testsupport.DefaultTime), testsupport.NewSequentialIDGenerator(), zap.NewNop(), WithHistory(history))
+
+	httpCtx := audit.WithActor(context.Background(), audit.Actor{ID: "user-1", Source: models.SourceHTTP})
+	sqsCtx := audit.WithActor(context.Background(), audit.Actor{ID: "sqs-listener", Source: models.SourceSQS})
+
+	created, err := repo.CreateDevice(httpCtx, models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "thermostat",
+		HomeID: "home-1",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.UpdateDevice(httpCtx, created.ID, models.Device{Name: "Renamed"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// A failed write records nothing
+	stale := int64(1)
+	if _, err := repo.UpdateDevice(httpCtx, created.ID, models.Device{Name: "Stale"}, &stale); !stderrors.Is(err, errors.ErrDomainVersionMismatch) {
+		t.Fatalf("Expected version mismatch, got %v", err)
+	}
+	if _, err := repo.UpdateDeviceHomeID(sqsCtx, created.ID, "home-2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.DeleteDevice(httpCtx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.RestoreDevice(httpCtx, created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	page, err := history.GetHistory(context.Background(), created.ID, 10, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 5 {
+		t.Fatalf("Expected 5 history entries, got %+v", page.Items)
+	}
+
+	restored, deleted, moved, renamed, first := page.Items[0], page.Items[1], page.Items[2], page.Items[3], page.Items[4]
+	if first.Type != models.EventDeviceCreated || len(first.Changes) != 4 || first.Actor != "user-1" || first.Source != models.SourceHTTP {
+		t.Errorf("Expected create entry with every field, got %+v", first)
+	}
+	if renamed.Type != models.EventDeviceUpdated || len(renamed.Changes) != 1 ||
+		renamed.Changes[0] != (models.FieldChange{Field: "name", Old: "Test Device", New: "Renamed"}) {
+		t.Errorf("Expected name change, got %+v", renamed)
+	}
+	if moved.Type != models.EventDeviceHomeChanged || moved.Actor != "sqs-listener" || moved.Source != models.SourceSQS ||
+		len(moved.Changes) != 1 || moved.Changes[0] != (models.FieldChange{Field: "homeId", Old: "home-1", New: "home-2"}) {
+		t.Errorf("Expected home change from SQS, got %+v", moved)
+	}
+	// Deleting and restoring only move the tombstone
+	if deleted.Type != models.EventDeviceDeleted || len(deleted.Changes) != 0 {
+		t.Errorf("Expected delete entry without field changes, got %+v", deleted)
+	}
+	if restored.Type != models.EventDeviceRestored || len(restored.Changes) != 0 {
+		t.Errorf("Expected restore entry without field changes, got %+v", restored)
+	}
+}
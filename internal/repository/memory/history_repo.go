@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"sync"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+)
+
+var _ services.DeviceHistoryRepository = (*HistoryRepository)(nil)
+
+// HistoryRepository is the in-memory services.DeviceHistoryRepository. Page
+// tokens hold the number of entries already returned.
+type HistoryRepository struct {
+	mu      sync.RWMutex
+	entries map[string][]models.DeviceHistoryEntry // device ID -> entries, oldest first
+}
+
+func NewHistoryRepository() *HistoryRepository {
+	return &HistoryRepository{
+		entries: make(map[string][]models.DeviceHistoryEntry),
+	}
+}
+
+// AppendHistory stores an entry; DeviceRepository calls it for every write
+// when configured WithHistory
+func (r *HistoryRepository) AppendHistory(_ context.Context, entry models.DeviceHistoryEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[entry.DeviceID] = append(r.entries[entry.DeviceID], entry)
+	return nil
+}
+
+func (r *HistoryRepository) GetHistory(_ context.Context, deviceID string, limit int32, nextToken string) (*models.DeviceHistoryPage, error) {
+	skip := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err == nil {
+			skip, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || skip < 0 {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetHistory").
+				WithLayer("repository")
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.entries[deviceID]
+	page := &models.DeviceHistoryPage{
+		Items: []models.DeviceHistoryEntry{},
+	}
+	for i := len(entries) - 1 - skip; i >= 0; i-- {
+		if limit > 0 && len(page.Items) == int(limit) {
+			break
+		}
+		page.Items = append(page.Items, entries[i])
+	}
+	// Like DynamoDB, a full page yields a token even if nothing follows it
+	if limit > 0 && len(page.Items) == int(limit) {
+		page.NextToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(skip + len(page.Items))))
+	}
+
+	return page, nil
+}
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"example.com/smart-devices/internal/models"
+)
+
+func TestHistoryRepository_GetHistory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewHistoryRepository()
+
+	for i := 1; i <= 5; i++ {
+		entry := models.DeviceHistoryEntry{DeviceID: "device-1", ID: fmt.Sprintf("entry-%d", i), Timestamp: int64(i)}
+		if err := repo.AppendHistory(ctx, entry); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := repo.AppendHistory(ctx, models.DeviceHistoryEntry{DeviceID: "device-2", ID: "other"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var ids []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected pagination to finish")
+		}
+		page, err := repo.GetHistory(ctx, "device-1", 2, token)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, entry := range page.Items {
+			ids = append(ids, entry.ID)
+		}
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+
+	want := "[entry-5 entry-4 entry-3 entry-2 entry-1]"
+	if got := fmt.Sprint(ids); got != want {
+		t.Errorf("Expected %s newest first, got %s", want, got)
+	}
+
+	if _, err := repo.GetHistory(ctx, "device-1", 2, "%%%"); err == nil {
+		t.Error("Expected error for an invalid token")
+	}
+}
@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"sync"
+
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+	"go.uber.org/zap"
+)
+
+var _ services.HomeRepository = (*HomeRepository)(nil)
+
+// HomeRepository is the in-memory services.HomeRepository. Listings are
+// ordered by home ID so pagination is stable.
+type HomeRepository struct {
+	mu     sync.RWMutex
+	homes  map[string]models.Home
+	clock  clock.Clock
+	ids    idgen.IDGenerator
+	logger *zap.Logger
+}
+
+func NewHomeRepository(clk clock.Clock, ids idgen.IDGenerator, logger *zap.Logger) *HomeRepository {
+	return &HomeRepository{
+		homes:  make(map[string]models.Home),
+		clock:  clk,
+		ids:    ids,
+		logger: logger,
+	}
+}
+
+func (r *HomeRepository) GetHome(_ context.Context, id string) (*models.Home, error) {
+	r.logger.Debug("fetching home", zap.String("home_id", id))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	home, ok := r.homes[id]
+	if !ok {
+		return nil, errors.ErrDomainHomeNotFound.
+			WithOperation("GetHome").
+			WithLayer("repository").
+			WithContext("home_id", id)
+	}
+
+	return &home, nil
+}
+
+func (r *HomeRepository) GetHomes(_ context.Context, limit int32, nextToken string) (*models.HomePage, error) {
+	r.logger.Debug("fetching homes", zap.Int32("limit", limit))
+
+	var after string
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil || len(raw) == 0 {
+			return nil, errors.WrapError(errors.ErrorTypeValidation, "invalid pagination token", err).
+				WithOperation("GetHomes").
+				WithLayer("repository")
+		}
+		after = string(raw)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.homes))
+	for id := range r.homes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := sort.SearchStrings(ids, after)
+	if start < len(ids) && ids[start] == after {
+		start++
+	}
+
+	end := len(ids)
+	if limit > 0 && start+int(limit) < end {
+		end = start + int(limit)
+	}
+
+	page := &models.HomePage{
+		Items: make([]models.Home, 0, end-start),
+	}
+	for _, id := range ids[start:end] {
+		page.Items = append(page.Items, r.homes[id])
+	}
+	// Like DynamoDB, a full page yields a token even if nothing follows it
+	if limit > 0 && end-start == int(limit) {
+		page.NextToken = base64.RawURLEncoding.EncodeToString([]byte(ids[end-1]))
+	}
+
+	return page, nil
+}
+
+func (r *HomeRepository) CreateHome(_ context.Context, home models.Home) (models.Home, error) {
+	now := clock.NowMillis(r.clock)
+	home.ID = r.ids.NewID()
+	home.CreatedAt = now
+	home.ModifiedAt = now
+	home.Version = 1
+	home.DeviceCount = 0
+
+	r.logger.Debug("creating home", zap.String("home_id", home.ID))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.homes[home.ID] = home
+	return home, nil
+}
+
+func (r *HomeRepository) UpdateHome(_ context.Context, home models.Home) (*models.Home, error) {
+	r.logger.Debug("updating home", zap.String("home_id", home.ID))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.homes[home.ID]
+	if !ok {
+		return nil, errors.ErrDomainHomeNotFound.
+			WithOperation("UpdateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID)
+	}
+	if stored.Version != home.Version {
+		return nil, errors.ErrDomainHomeVersionMismatch.
+			WithOperation("UpdateHome").
+			WithLayer("repository").
+			WithContext("home_id", home.ID).
+			WithContext("expected_version", home.Version)
+	}
+
+	home.CreatedAt = stored.CreatedAt
+	home.DeviceCount = stored.DeviceCount
+	home.ModifiedAt = clock.NowMillis(r.clock)
+	home.Version++
+	r.homes[home.ID] = home
+
+	return &home, nil
+}
+
+func (r *HomeRepository) DeleteHome(_ context.Context, id string, expectedVersion *int64) error {
+	r.logger.Debug("deleting home", zap.String("home_id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.homes[id]
+	if !ok {
+		return errors.ErrDomainHomeNotFound.
+			WithOperation("DeleteHome").
+			WithLayer("repository").
+			WithContext("home_id", id)
+	}
+	if expectedVersion != nil && stored.Version != *expectedVersion {
+		return errors.ErrDomainHomeVersionMismatch.
+			WithOperation("DeleteHome").
+			WithLayer("repository").
+			WithContext("home_id", id).
+			WithContext("expected_version", *expectedVersion)
+	}
+	if stored.DeviceCount > 0 {
+		return errors.ErrDomainHomeNotEmpty.
+			WithOperation("DeleteHome").
+			WithLayer("repository").
+			WithContext("home_id", id).
+			WithContext("device_count", stored.DeviceCount)
+	}
+
+	delete(r.homes, id)
+	return nil
+}
+
+// moveDevice updates the device counts of the homes a device leaves and
+// joins, either of which may be empty. Like the DynamoDB repository's
+// transaction it changes nothing when a home does not exist.
+func (r *HomeRepository) moveDevice(operation string, id string, from string, to string) error {
+	if from == to {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.homes[to]; to != "" && !ok {
+		return errors.ErrDomainUnknownHome.
+			WithOperation(operation).
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("home_id", to)
+	}
+	if _, ok := r.homes[from]; from != "" && !ok {
+		return errors.WrapError(errors.ErrorTypeDatabase, "home of device does not exist", nil).
+			WithOperation(operation).
+			WithLayer("repository").
+			WithContext("device_id", id).
+			WithContext("home_id", from)
+	}
+
+	if to != "" {
+		home := r.homes[to]
+		home.DeviceCount++
+		r.homes[to] = home
+	}
+	if from != "" {
+		home := r.homes[from]
+		home.DeviceCount--
+		r.homes[from] = home
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"example.com/smart-devices/internal/repository/repotest"
+	"example.com/smart-devices/internal/services"
+	"example.com/smart-devices/pkg/testsupport"
+	"go.uber.org/zap"
+)
+
+func TestHomeRepository_Conformance(t *testing.T) {
+	repotest.RunHomeRepositoryConformance(t, func() services.HomeRepository {
+		clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+		clock.Step = time.Millisecond
+		return NewHomeRepository(clock, testsupport.NewSequentialIDGenerator(), zap.NewNop())
+	})
+}
+
+func TestHomeReference_Conformance(t *testing.T) {
+	repotest.RunHomeReferenceConformance(t, func() (services.DeviceRepository, services.HomeRepository) {
+		clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+		clock.Step = time.Millisecond
+		homes := NewHomeRepository(clock, testsupport.NewSequentialIDGenerator(), zap.NewNop())
+		return NewDeviceRepository(clock, testsupport.NewSequentialIDGenerator(), zap.NewNop(), WithHomes(homes)), homes
+	})
+}
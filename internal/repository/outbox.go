@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// outbox is the table device events are recorded in when outbox delivery is
+// enabled. Entries expire retention after they were written.
+type outbox struct {
+	tableName string
+	retention time.Duration
+}
+
+// DeviceRepositoryOption configures optional DeviceRepository behavior
+type DeviceRepositoryOption func(*DeviceRepository)
+
+// WithOutbox makes every write record its device events as
+// models.OutboxEntry items in tableName, in the same transaction as the write.
+// A relay reading the table's stream delivers them, so an event is never lost
+// between storing a change and publishing it.
+func WithOutbox(tableName string, retention time.Duration) DeviceRepositoryOption {
+	return func(r *DeviceRepository) {
+		r.outbox = &outbox{
+			tableName: tableName,
+			retention: retention,
+		}
+	}
+}
+
+// outboxPuts builds the outbox puts for events; callers only build events
+// when r.outbox is set
+func (r *DeviceRepository) outboxPuts(events ...models.DeviceEvent) ([]types.TransactWriteItem, error) {
+	now := r.clock.Now()
+	items := make([]types.TransactWriteItem, 0, len(events))
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to marshal device event", err).
+				WithOperation("OutboxPut").
+				WithLayer("repository").
+				WithContext("device_id", event.DeviceID)
+		}
+
+		item, err := attributevalue.MarshalMap(models.OutboxEntry{
+			ID:        event.ID,
+			DeviceID:  event.DeviceID,
+			EventType: event.Type,
+			Event:     string(body),
+			Status:    models.OutboxStatusPending,
+			CreatedAt: now.UnixMilli(),
+			ExpiresAt: now.Add(r.outbox.retention).Unix(),
+		})
+		if err != nil {
+			return nil, errors.WrapError(errors.ErrorTypeDatabase, "failed to marshal outbox entry", err).
+				WithOperation("OutboxPut").
+				WithLayer("repository").
+				WithContext("device_id", event.DeviceID)
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: aws.String(r.outbox.tableName),
+				Item:      item,
+			},
+		})
+	}
+
+	return items, nil
+}
+
+// newEvent builds a device event stamped with the repository's clock
+func (r *DeviceRepository) newEvent(eventType string, id string, before *models.Device, after *models.Device) models.DeviceEvent {
+	return models.DeviceEvent{
+		ID:         r.ids.NewID(),
+		Type:       eventType,
+		DeviceID:   id,
+		OccurredAt: clock.NowMillis(r.clock),
+		Before:     before,
+		After:      after,
+	}
+}
+
+// OutboxStore reads and updates outbox entries for the outbox relay
+type OutboxStore struct {
+	client    *dynamodb.Client
+	tableName string
+	clock     clock.Clock
+	logger    *zap.Logger
+}
+
+func NewOutboxStore(client *dynamodb.Client, tableName string, clk clock.Clock, logger *zap.Logger) *OutboxStore {
+	return &OutboxStore{
+		client:    client,
+		tableName: tableName,
+		clock:     clk,
+		logger:    logger,
+	}
+}
+
+// IsSent reports whether the entry was already delivered. An entry that no
+// longer exists has expired and counts as sent.
+func (s *OutboxStore) IsSent(ctx context.Context, id string) (bool, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: &s.tableName,
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		ConsistentRead:           aws.Bool(true),
+		ProjectionExpression:     aws.String("#status"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+	})
+	if err != nil {
+		s.logger.Error("failed to get outbox entry", zap.String("entry_id", id), zap.Error(err))
+		return false, errors.WrapError(errors.ErrorTypeDatabase, "failed to get outbox entry", err).
+			WithOperation("IsSent").
+			WithLayer("repository").
+			WithContext("entry_id", id)
+	}
+	if result.Item == nil {
+		return true, nil
+	}
+
+	status, _ := result.Item["status"].(*types.AttributeValueMemberS)
+	return status != nil && status.Value == models.OutboxStatusSent, nil
+}
+
+// MarkSent records that the entry was delivered
+func (s *OutboxStore) MarkSent(ctx context.Context, id string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &s.tableName,
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression: aws.String("SET #status = :sent, #sentAt = :sentAt"),
+		// Never recreate an entry that expired in the meantime
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+			"#sentAt": "sentAt",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sent":   &types.AttributeValueMemberS{Value: models.OutboxStatusSent},
+			":sentAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(clock.NowMillis(s.clock), 10)},
+		},
+	})
+	if err != nil {
+		var conditionErr *types.ConditionalCheckFailedException
+		if stderrors.As(err, &conditionErr) {
+			return nil
+		}
+
+		s.logger.Error("failed to mark outbox entry sent", zap.String("entry_id", id), zap.Error(err))
+		return errors.WrapError(errors.ErrorTypeDatabase, "failed to mark outbox entry sent", err).
+			WithOperation("MarkSent").
+			WithLayer("repository").
+			WithContext("entry_id", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// encodePageToken converts a DynamoDB LastEvaluatedKey into an opaque,
+// URL-safe token that clients can pass back to fetch the next page
+func encodePageToken(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	var plain map[string]interface{}
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", err
+	}
+
+	raw, err := json.Marshal(plain)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodePageToken converts a token produced by encodePageToken back into
+// an ExclusiveStartKey
+func decodePageToken(token string) (map[string]types.AttributeValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain map[string]interface{}
+	if err := json.Unmarshal(raw, &plain); err != nil {
+		return nil, err
+	}
+	if len(plain) == 0 {
+		return nil, fmt.Errorf("page token contains no key attributes")
+	}
+
+	return attributevalue.MarshalMap(plain)
+}
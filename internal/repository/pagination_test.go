@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	stderrors "errors"
+	"reflect"
+	"testing"
+
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+func TestPageToken_RoundTrip(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"id":     &types.AttributeValueMemberS{Value: "00000000-0000-4000-8000-000000000001"},
+		"homeId": &types.AttributeValueMemberS{Value: "home-1"},
+	}
+
+	token, err := encodePageToken(key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if token == "" {
+		t.Fatal("Expected a token for a non-empty key")
+	}
+
+	decoded, err := decodePageToken(token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, key) {
+		t.Errorf("Expected %v after the round trip, got %v", key, decoded)
+	}
+
+	// The last page has no LastEvaluatedKey and yields no token
+	if token, err := encodePageToken(nil); err != nil || token != "" {
+		t.Errorf("Expected an empty token for an empty key, got %q, %v", token, err)
+	}
+}
+
+func TestDecodePageToken_Malformed(t *testing.T) {
+	tokens := map[string]string{
+		"not base64":   "!!!",
+		"not JSON":     base64.RawURLEncoding.EncodeToString([]byte("id=1")),
+		"not a key":    base64.RawURLEncoding.EncodeToString([]byte(`["id"]`)),
+		"empty object": base64.RawURLEncoding.EncodeToString([]byte(`{}`)),
+	}
+
+	for name, token := range tokens {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodePageToken(token); err == nil {
+				t.Errorf("Expected an error for %q", token)
+			}
+		})
+	}
+}
+
+// A malformed token is the client's fault, so it must surface as a 400
+// validation error rather than a 500. The token is rejected before DynamoDB
+// is called, so no client is needed.
+func TestDeviceRepository_GetDevices_MalformedToken(t *testing.T) {
+	repo := NewDeviceRepository(nil, "devices", "device-macs", clock.SystemClock{}, idgen.UUIDGenerator{}, zap.NewNop())
+
+	_, err := repo.GetDevices(context.Background(), 10, "!!!")
+
+	var domainErr *errors.DomainError
+	if !stderrors.As(err, &domainErr) || domainErr.Type != errors.ErrorTypeValidation || domainErr.StatusCode != 400 {
+		t.Fatalf("Expected a 400 validation error, got %v", err)
+	}
+}
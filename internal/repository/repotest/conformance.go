@@ -0,0 +1,475 @@
+// Package repotest provides a conformance suite that every
+// services.DeviceRepository implementation must pass.
+package repotest
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+)
+
+// millisThreshold is the smallest plausible Unix millisecond timestamp;
+// anything below it was written with second resolution
+const millisThreshold = int64(100_000_000_000)
+
+const (
+	homeA = "11111111-1111-4111-8111-111111111111"
+	homeB = "22222222-2222-4222-8222-222222222222"
+)
+
+// RunRepositoryConformance runs the shared behavioral tests against the
+// repository returned by newRepo. newRepo is called once per subtest and must
+// return an empty repository.
+func RunRepositoryConformance(t *testing.T, newRepo func() services.DeviceRepository) {
+	t.Run("CreateDevice", func(t *testing.T) { testCreateDevice(t, newRepo()) })
+	t.Run("CreateDevice_DuplicateMAC", func(t *testing.T) { testCreateDeviceDuplicateMAC(t, newRepo()) })
+	t.Run("GetDevice", func(t *testing.T) { testGetDevice(t, newRepo()) })
+	t.Run("GetDevices_Empty", func(t *testing.T) { testGetDevicesEmpty(t, newRepo()) })
+	t.Run("GetDevices_Pagination", func(t *testing.T) { testGetDevicesPagination(t, newRepo()) })
+	t.Run("GetDevices_InvalidToken", func(t *testing.T) { testGetDevicesInvalidToken(t, newRepo()) })
+	t.Run("GetDevicesByHome", func(t *testing.T) { testGetDevicesByHome(t, newRepo()) })
+	t.Run("UpdateDevice", func(t *testing.T) { testUpdateDevice(t, newRepo()) })
+	t.Run("UpdateDevice_NotFound", func(t *testing.T) { testUpdateDeviceNotFound(t, newRepo()) })
+	t.Run("UpdateDevice_VersionMismatch", func(t *testing.T) { testUpdateDeviceVersionMismatch(t, newRepo()) })
+	t.Run("DeleteDevice", func(t *testing.T) { testDeleteDevice(t, newRepo()) })
+	t.Run("DeleteDevice_VersionMismatch", func(t *testing.T) { testDeleteDeviceVersionMismatch(t, newRepo()) })
+	t.Run("DeleteDevice_NotFound", func(t *testing.T) { testDeleteDeviceNotFound(t, newRepo()) })
+	t.Run("DeleteDevice_HidesTombstone", func(t *testing.T) { testDeleteDeviceHidesTombstone(t, newRepo()) })
+	t.Run("RestoreDevice", func(t *testing.T) { testRestoreDevice(t, newRepo()) })
+	t.Run("RestoreDevice_MACTaken", func(t *testing.T) { testRestoreDeviceMACTaken(t, newRepo()) })
+	t.Run("UpdateDeviceHomeID", func(t *testing.T) { testUpdateDeviceHomeID(t, newRepo()) })
+	t.Run("UpdateDeviceHomeID_NotFound", func(t *testing.T) { testUpdateDeviceHomeIDNotFound(t, newRepo()) })
+	t.Run("UnassignDeviceHome", func(t *testing.T) { testUnassignDeviceHome(t, newRepo()) })
+}
+
+func newDevice(n int, homeID string) models.Device {
+	return models.Device{
+		MAC:    fmt.Sprintf("00:11:22:33:44:%02x", n),
+		Name:   fmt.Sprintf("Device %d", n),
+		Type:   "sensor",
+		HomeID: homeID,
+	}
+}
+
+func mustCreate(t *testing.T, repo services.DeviceRepository, device models.Device) models.Device {
+	t.Helper()
+
+	created, err := repo.CreateDevice(context.Background(), device)
+	if err != nil {
+		t.Fatalf("CreateDevice: expected no error, got %v", err)
+	}
+	return created
+}
+
+func expectErrorType(t *testing.T, err error, target *errors.DomainError) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("Expected %s error, got nil", target.Type)
+	}
+	if !stderrors.Is(err, target) {
+		t.Fatalf("Expected %s error, got %v", target.Type, err)
+	}
+}
+
+func testCreateDevice(t *testing.T, repo services.DeviceRepository) {
+	device := newDevice(1, homeA)
+	device.MAC = "aa-bb-cc-dd-ee-01"
+
+	created := mustCreate(t, repo, device)
+
+	if created.ID == "" {
+		t.Error("Expected device ID to be set")
+	}
+	if created.MAC != "AA:BB:CC:DD:EE:01" {
+		t.Errorf("Expected normalized MAC AA:BB:CC:DD:EE:01, got %s", created.MAC)
+	}
+	if created.CreatedAt < millisThreshold {
+		t.Errorf("Expected CreatedAt in Unix milliseconds, got %d", created.CreatedAt)
+	}
+	if created.ModifiedAt != created.CreatedAt {
+		t.Errorf("Expected ModifiedAt %d to equal CreatedAt %d", created.ModifiedAt, created.CreatedAt)
+	}
+	if created.Version != 1 {
+		t.Errorf("Expected version 1, got %d", created.Version)
+	}
+}
+
+func testCreateDeviceDuplicateMAC(t *testing.T, repo services.DeviceRepository) {
+	device := newDevice(1, homeA)
+	device.MAC = "aa:bb:cc:dd:ee:ff"
+	mustCreate(t, repo, device)
+
+	duplicate := newDevice(2, homeB)
+	duplicate.MAC = "AA-BB-CC-DD-EE-FF"
+	_, err := repo.CreateDevice(context.Background(), duplicate)
+	expectErrorType(t, err, errors.ErrDomainDeviceExists)
+}
+
+func testGetDevice(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	got, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *got != created {
+		t.Errorf("Expected %+v, got %+v", created, *got)
+	}
+
+	_, err = repo.GetDevice(ctx, "00000000-0000-4000-8000-ffffffffffff")
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+}
+
+func testGetDevicesEmpty(t *testing.T, repo services.DeviceRepository) {
+	_, err := repo.GetDevices(context.Background(), 10, "")
+	expectErrorType(t, err, errors.ErrDomainNoDevicesFound)
+}
+
+func testGetDevicesPagination(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+
+	want := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		want[mustCreate(t, repo, newDevice(i, homeA)).ID] = true
+	}
+
+	seen := make(map[string]bool)
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Pagination did not terminate")
+		}
+
+		page, err := repo.GetDevices(ctx, 2, token)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(page.Items) > 2 {
+			t.Fatalf("Expected at most 2 items per page, got %d", len(page.Items))
+		}
+		for _, device := range page.Items {
+			if seen[device.ID] {
+				t.Errorf("Device %s returned twice", device.ID)
+			}
+			seen[device.ID] = true
+		}
+
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+
+	if len(seen) != len(want) {
+		t.Errorf("Expected %d devices across pages, got %d", len(want), len(seen))
+	}
+	for id := range want {
+		if !seen[id] {
+			t.Errorf("Device %s missing from pages", id)
+		}
+	}
+}
+
+func testGetDevicesInvalidToken(t *testing.T, repo services.DeviceRepository) {
+	mustCreate(t, repo, newDevice(1, homeA))
+
+	_, err := repo.GetDevices(context.Background(), 10, "%%not-a-token%%")
+	expectErrorType(t, err, errors.NewDomainError(errors.ErrorTypeValidation, ""))
+}
+
+func testGetDevicesByHome(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+
+	inA := map[string]bool{
+		mustCreate(t, repo, newDevice(1, homeA)).ID: true,
+		mustCreate(t, repo, newDevice(2, homeA)).ID: true,
+	}
+	mustCreate(t, repo, newDevice(3, homeB))
+
+	devices, err := repo.GetDevicesByHome(ctx, homeA)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(devices) != len(inA) {
+		t.Fatalf("Expected %d devices, got %d", len(inA), len(devices))
+	}
+	for _, device := range devices {
+		if !inA[device.ID] {
+			t.Errorf("Unexpected device %s in home %s", device.ID, homeA)
+		}
+	}
+
+	_, err = repo.GetDevicesByHome(ctx, "33333333-3333-4333-8333-333333333333")
+	expectErrorType(t, err, errors.ErrDomainNoDevicesFound)
+}
+
+func testUpdateDevice(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	change, err := repo.UpdateDevice(ctx, created.ID, models.Device{Name: "Renamed", HomeID: homeB}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if change.Before.Name != created.Name || change.Before.HomeID != homeA || change.Before.Version != created.Version {
+		t.Errorf("Expected the device as created before the update, got %+v", *change.Before)
+	}
+	updated := change.After
+	if updated.Name != "Renamed" || updated.HomeID != homeB {
+		t.Errorf("Expected name and homeId to be updated, got %+v", *updated)
+	}
+	if updated.Type != created.Type || updated.MAC != created.MAC || updated.CreatedAt != created.CreatedAt {
+		t.Errorf("Expected untouched fields to be preserved, got %+v", *updated)
+	}
+	if updated.ModifiedAt < created.ModifiedAt || updated.ModifiedAt < millisThreshold {
+		t.Errorf("Expected ModifiedAt in milliseconds and not before %d, got %d", created.ModifiedAt, updated.ModifiedAt)
+	}
+	if updated.Version != created.Version+1 {
+		t.Errorf("Expected version %d, got %d", created.Version+1, updated.Version)
+	}
+
+	stored, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *stored != *updated {
+		t.Errorf("Expected stored device %+v to match update result %+v", *stored, *updated)
+	}
+}
+
+func testUpdateDeviceNotFound(t *testing.T, repo services.DeviceRepository) {
+	_, err := repo.UpdateDevice(context.Background(), "00000000-0000-4000-8000-ffffffffffff", models.Device{Name: "Ghost"}, nil)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+}
+
+func testUpdateDeviceVersionMismatch(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	version := created.Version
+	if _, err := repo.UpdateDevice(ctx, created.ID, models.Device{Name: "First"}, &version); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err := repo.UpdateDevice(ctx, created.ID, models.Device{Name: "Second"}, &version)
+	expectErrorType(t, err, errors.ErrDomainVersionMismatch)
+
+	stored, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Name != "First" {
+		t.Errorf("Expected stale update to be rejected, got name %s", stored.Name)
+	}
+}
+
+func testDeleteDevice(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	device := newDevice(1, homeA)
+	created := mustCreate(t, repo, device)
+
+	change, err := repo.DeleteDevice(ctx, created.ID, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if change.Before.ID != created.ID || change.Before.DeletedAt != 0 || change.Before.Version != created.Version {
+		t.Errorf("Expected the device as created before the delete, got %+v", *change.Before)
+	}
+	deleted := change.After
+	if deleted.ID != created.ID || deleted.Name != created.Name || deleted.DeletedAt == 0 || deleted.Version != created.Version+1 {
+		t.Errorf("Expected the deleted device to be returned, got %+v", deleted)
+	}
+
+	_, err = repo.GetDevice(ctx, created.ID)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+
+	// The MAC is released and can be registered again
+	mustCreate(t, repo, device)
+}
+
+func testDeleteDeviceVersionMismatch(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	stale := created.Version - 1
+	_, err := repo.DeleteDevice(ctx, created.ID, &stale)
+	expectErrorType(t, err, errors.ErrDomainVersionMismatch)
+
+	if _, err := repo.GetDevice(ctx, created.ID); err != nil {
+		t.Errorf("Expected device to survive a stale delete, got %v", err)
+	}
+}
+
+func testDeleteDeviceNotFound(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+
+	_, err := repo.DeleteDevice(ctx, "00000000-0000-4000-8000-ffffffffffff", nil)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+
+	// A device that is already deleted cannot be deleted again
+	created := mustCreate(t, repo, newDevice(1, homeA))
+	if _, err := repo.DeleteDevice(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_, err = repo.DeleteDevice(ctx, created.ID, nil)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+}
+
+func testDeleteDeviceHidesTombstone(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	deleted := mustCreate(t, repo, newDevice(1, homeA))
+	kept := mustCreate(t, repo, newDevice(2, homeA))
+
+	if _, err := repo.DeleteDevice(ctx, deleted.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	page, err := repo.GetDevices(ctx, 10, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != kept.ID {
+		t.Errorf("Expected only %s to be listed, got %+v", kept.ID, page.Items)
+	}
+
+	devices, err := repo.GetDevicesByHome(ctx, homeA)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != kept.ID {
+		t.Errorf("Expected only %s in home %s, got %+v", kept.ID, homeA, devices)
+	}
+
+	_, err = repo.UpdateDevice(ctx, deleted.ID, models.Device{Name: "Renamed"}, nil)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+	_, err = repo.UpdateDeviceHomeID(ctx, deleted.ID, homeB)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+}
+
+func testRestoreDevice(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	_, err := repo.RestoreDevice(ctx, created.ID)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotDeleted)
+	_, err = repo.RestoreDevice(ctx, "00000000-0000-4000-8000-ffffffffffff")
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+
+	if _, err := repo.DeleteDevice(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	restored, err := repo.RestoreDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if restored.ID != created.ID || restored.MAC != created.MAC || restored.HomeID != created.HomeID {
+		t.Errorf("Expected %+v to be restored, got %+v", created, restored)
+	}
+	if restored.DeletedAt != 0 {
+		t.Errorf("Expected tombstone to be cleared, got deletedAt %d", restored.DeletedAt)
+	}
+	// Delete and restore are both writes
+	if restored.Version != created.Version+2 {
+		t.Errorf("Expected version %d, got %d", created.Version+2, restored.Version)
+	}
+
+	stored, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected restored device to be readable, got %v", err)
+	}
+	if *stored != *restored {
+		t.Errorf("Expected stored device %+v to match %+v", stored, restored)
+	}
+
+	// The restored device owns its MAC again
+	_, err = repo.CreateDevice(ctx, newDevice(1, homeB))
+	expectErrorType(t, err, errors.ErrDomainDeviceExists)
+}
+
+func testRestoreDeviceMACTaken(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	if _, err := repo.DeleteDevice(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	mustCreate(t, repo, newDevice(1, homeB))
+
+	_, err := repo.RestoreDevice(ctx, created.ID)
+	expectErrorType(t, err, errors.ErrDomainDeviceExists)
+
+	_, err = repo.GetDevice(ctx, created.ID)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+}
+
+func testUpdateDeviceHomeID(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	change, err := repo.UpdateDeviceHomeID(ctx, created.ID, homeB)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if change.Before.HomeID != homeA || change.Before.Version != created.Version {
+		t.Errorf("Expected the device as created before the move, got %+v", *change.Before)
+	}
+
+	stored, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *stored != *change.After {
+		t.Errorf("Expected stored device %+v to match update result %+v", *stored, *change.After)
+	}
+	if stored.HomeID != homeB {
+		t.Errorf("Expected home ID %s, got %s", homeB, stored.HomeID)
+	}
+	if stored.ModifiedAt < created.ModifiedAt || stored.ModifiedAt < millisThreshold {
+		t.Errorf("Expected ModifiedAt in milliseconds and not before %d, got %d", created.ModifiedAt, stored.ModifiedAt)
+	}
+	if stored.Version != created.Version+1 {
+		t.Errorf("Expected version %d, got %d", created.Version+1, stored.Version)
+	}
+}
+
+func testUpdateDeviceHomeIDNotFound(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	missing := "00000000-0000-4000-8000-ffffffffffff"
+
+	_, err := repo.UpdateDeviceHomeID(ctx, missing, homeB)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+
+	// The failed update must not leave a partial item behind
+	_, err = repo.GetDevice(ctx, missing)
+	expectErrorType(t, err, errors.ErrDomainDeviceNotFound)
+	_, err = repo.GetDevices(ctx, 10, "")
+	expectErrorType(t, err, errors.ErrDomainNoDevicesFound)
+}
+
+func testUnassignDeviceHome(t *testing.T, repo services.DeviceRepository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, newDevice(1, homeA))
+
+	if _, err := repo.UpdateDeviceHomeID(ctx, created.ID, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stored, err := repo.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.HomeID != "" {
+		t.Errorf("Expected device to be unassigned, got home ID %s", stored.HomeID)
+	}
+
+	_, err = repo.GetDevicesByHome(ctx, homeA)
+	expectErrorType(t, err, errors.ErrDomainNoDevicesFound)
+}
@@ -0,0 +1,292 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/services"
+)
+
+// RunHomeRepositoryConformance runs the shared behavioral tests against the
+// home repository returned by newRepo. newRepo is called once per subtest and
+// must return an empty repository.
+func RunHomeRepositoryConformance(t *testing.T, newRepo func() services.HomeRepository) {
+	t.Run("CreateHome", func(t *testing.T) { testCreateHome(t, newRepo()) })
+	t.Run("GetHome", func(t *testing.T) { testGetHome(t, newRepo()) })
+	t.Run("GetHomes_Empty", func(t *testing.T) { testGetHomesEmpty(t, newRepo()) })
+	t.Run("GetHomes_Pagination", func(t *testing.T) { testGetHomesPagination(t, newRepo()) })
+	t.Run("UpdateHome", func(t *testing.T) { testUpdateHome(t, newRepo()) })
+	t.Run("UpdateHome_NotFound", func(t *testing.T) { testUpdateHomeNotFound(t, newRepo()) })
+	t.Run("UpdateHome_VersionMismatch", func(t *testing.T) { testUpdateHomeVersionMismatch(t, newRepo()) })
+	t.Run("DeleteHome", func(t *testing.T) { testDeleteHome(t, newRepo()) })
+	t.Run("DeleteHome_VersionMismatch", func(t *testing.T) { testDeleteHomeVersionMismatch(t, newRepo()) })
+}
+
+func newHome(n int) models.Home {
+	return models.Home{
+		Name:     fmt.Sprintf("Home %d", n),
+		Timezone: "Europe/Berlin",
+		Owner:    "user-1",
+	}
+}
+
+func mustCreateHome(t *testing.T, repo services.HomeRepository, home models.Home) models.Home {
+	t.Helper()
+
+	created, err := repo.CreateHome(context.Background(), home)
+	if err != nil {
+		t.Fatalf("CreateHome: expected no error, got %v", err)
+	}
+	return created
+}
+
+func testCreateHome(t *testing.T, repo services.HomeRepository) {
+	created := mustCreateHome(t, repo, newHome(1))
+
+	if created.ID == "" {
+		t.Error("Expected home ID to be set")
+	}
+	if created.CreatedAt < millisThreshold {
+		t.Errorf("Expected CreatedAt in Unix milliseconds, got %d", created.CreatedAt)
+	}
+	if created.ModifiedAt != created.CreatedAt {
+		t.Errorf("Expected ModifiedAt %d to equal CreatedAt %d", created.ModifiedAt, created.CreatedAt)
+	}
+	if created.Version != 1 {
+		t.Errorf("Expected version 1, got %d", created.Version)
+	}
+}
+
+func testGetHome(t *testing.T, repo services.HomeRepository) {
+	ctx := context.Background()
+	created := mustCreateHome(t, repo, newHome(1))
+
+	got, err := repo.GetHome(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *got != created {
+		t.Errorf("Expected %+v, got %+v", created, *got)
+	}
+
+	_, err = repo.GetHome(ctx, "00000000-0000-4000-8000-ffffffffffff")
+	expectErrorType(t, err, errors.ErrDomainHomeNotFound)
+}
+
+func testGetHomesEmpty(t *testing.T, repo services.HomeRepository) {
+	page, err := repo.GetHomes(context.Background(), 10, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 0 || page.NextToken != "" {
+		t.Errorf("Expected an empty page, got %+v", page)
+	}
+}
+
+func testGetHomesPagination(t *testing.T, repo services.HomeRepository) {
+	ctx := context.Background()
+
+	want := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		want[mustCreateHome(t, repo, newHome(i)).ID] = true
+	}
+
+	seen := make(map[string]bool)
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Pagination did not terminate")
+		}
+
+		page, err := repo.GetHomes(ctx, 2, token)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, home := range page.Items {
+			if seen[home.ID] {
+				t.Errorf("Home %s returned twice", home.ID)
+			}
+			seen[home.ID] = true
+		}
+
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+
+	if len(seen) != len(want) {
+		t.Errorf("Expected %d homes across pages, got %d", len(want), len(seen))
+	}
+}
+
+func testUpdateHome(t *testing.T, repo services.HomeRepository) {
+	ctx := context.Background()
+	created := mustCreateHome(t, repo, newHome(1))
+
+	changed := created
+	changed.Name = "Renamed"
+	changed.Address = "1 Main St"
+
+	updated, err := repo.UpdateHome(ctx, changed)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Name != "Renamed" || updated.Address != "1 Main St" {
+		t.Errorf("Expected updated fields, got %+v", updated)
+	}
+	if updated.Version != created.Version+1 {
+		t.Errorf("Expected version %d, got %d", created.Version+1, updated.Version)
+	}
+	if updated.CreatedAt != created.CreatedAt {
+		t.Errorf("Expected CreatedAt %d to be preserved, got %d", created.CreatedAt, updated.CreatedAt)
+	}
+
+	got, err := repo.GetHome(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if *got != *updated {
+		t.Errorf("Expected stored home %+v, got %+v", *updated, *got)
+	}
+}
+
+func testUpdateHomeNotFound(t *testing.T, repo services.HomeRepository) {
+	home := newHome(1)
+	home.ID = "00000000-0000-4000-8000-ffffffffffff"
+	home.Version = 1
+
+	_, err := repo.UpdateHome(context.Background(), home)
+	expectErrorType(t, err, errors.ErrDomainHomeNotFound)
+}
+
+func testUpdateHomeVersionMismatch(t *testing.T, repo services.HomeRepository) {
+	created := mustCreateHome(t, repo, newHome(1))
+
+	stale := created
+	stale.Version = created.Version + 1
+	_, err := repo.UpdateHome(context.Background(), stale)
+	expectErrorType(t, err, errors.ErrDomainHomeVersionMismatch)
+}
+
+func testDeleteHome(t *testing.T, repo services.HomeRepository) {
+	ctx := context.Background()
+	created := mustCreateHome(t, repo, newHome(1))
+
+	if err := repo.DeleteHome(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err := repo.GetHome(ctx, created.ID)
+	expectErrorType(t, err, errors.ErrDomainHomeNotFound)
+
+	err = repo.DeleteHome(ctx, created.ID, nil)
+	expectErrorType(t, err, errors.ErrDomainHomeNotFound)
+}
+
+func testDeleteHomeVersionMismatch(t *testing.T, repo services.HomeRepository) {
+	created := mustCreateHome(t, repo, newHome(1))
+
+	stale := created.Version + 1
+	err := repo.DeleteHome(context.Background(), created.ID, &stale)
+	expectErrorType(t, err, errors.ErrDomainHomeVersionMismatch)
+}
+
+// RunHomeReferenceConformance runs the tests of device writes that reference
+// homes against the device and home repositories returned by newRepos, which
+// must share storage with home checks enabled. newRepos is called once per
+// subtest and must return empty repositories.
+func RunHomeReferenceConformance(t *testing.T, newRepos func() (services.DeviceRepository, services.HomeRepository)) {
+	t.Run("UnknownHome", func(t *testing.T) { testUnknownHome(t, newRepos) })
+	t.Run("DeviceCount", func(t *testing.T) { testDeviceCount(t, newRepos) })
+}
+
+func expectDeviceCount(t *testing.T, homes services.HomeRepository, id string, want int64) {
+	t.Helper()
+
+	home, err := homes.GetHome(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetHome: expected no error, got %v", err)
+	}
+	if home.DeviceCount != want {
+		t.Errorf("Expected %d devices in home %s, got %d", want, id, home.DeviceCount)
+	}
+}
+
+func testUnknownHome(t *testing.T, newRepos func() (services.DeviceRepository, services.HomeRepository)) {
+	ctx := context.Background()
+	devices, homes := newRepos()
+	home := mustCreateHome(t, homes, newHome(1))
+
+	_, err := devices.CreateDevice(ctx, newDevice(1, "missing-home"))
+	expectErrorType(t, err, errors.ErrDomainUnknownHome)
+	// The MAC was not claimed by the failed create
+	created := mustCreate(t, devices, newDevice(1, home.ID))
+
+	_, err = devices.UpdateDevice(ctx, created.ID, models.Device{HomeID: "missing-home"}, nil)
+	expectErrorType(t, err, errors.ErrDomainUnknownHome)
+	_, err = devices.UpdateDeviceHomeID(ctx, created.ID, "missing-home")
+	expectErrorType(t, err, errors.ErrDomainUnknownHome)
+
+	stored, err := devices.GetDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetDevice: expected no error, got %v", err)
+	}
+	if stored.HomeID != home.ID || stored.Version != created.Version {
+		t.Errorf("Expected the device unchanged in home %s, got %+v", home.ID, stored)
+	}
+	expectDeviceCount(t, homes, home.ID, 1)
+}
+
+func testDeviceCount(t *testing.T, newRepos func() (services.DeviceRepository, services.HomeRepository)) {
+	ctx := context.Background()
+	devices, homes := newRepos()
+	first := mustCreateHome(t, homes, newHome(1))
+	second := mustCreateHome(t, homes, newHome(2))
+
+	device := mustCreate(t, devices, newDevice(1, first.ID))
+	mustCreate(t, devices, newDevice(2, first.ID))
+	expectDeviceCount(t, homes, first.ID, 2)
+
+	err := homes.DeleteHome(ctx, first.ID, nil)
+	expectErrorType(t, err, errors.ErrDomainHomeNotEmpty)
+
+	// Editing the home keeps its count
+	first.Name = "Renamed"
+	if _, err := homes.UpdateHome(ctx, first); err != nil {
+		t.Fatalf("UpdateHome: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, first.ID, 2)
+
+	if _, err := devices.UpdateDevice(ctx, device.ID, models.Device{HomeID: second.ID}, nil); err != nil {
+		t.Fatalf("UpdateDevice: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, first.ID, 1)
+	expectDeviceCount(t, homes, second.ID, 1)
+
+	if _, err := devices.UpdateDeviceHomeID(ctx, device.ID, ""); err != nil {
+		t.Fatalf("UpdateDeviceHomeID: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, second.ID, 0)
+	if err := homes.DeleteHome(ctx, second.ID, nil); err != nil {
+		t.Fatalf("DeleteHome: expected no error for an empty home, got %v", err)
+	}
+
+	if _, err := devices.UpdateDeviceHomeID(ctx, device.ID, first.ID); err != nil {
+		t.Fatalf("UpdateDeviceHomeID: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, first.ID, 2)
+
+	// Tombstones do not count, and a restored device counts again
+	if _, err := devices.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("DeleteDevice: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, first.ID, 1)
+	if _, err := devices.RestoreDevice(ctx, device.ID); err != nil {
+		t.Fatalf("RestoreDevice: expected no error, got %v", err)
+	}
+	expectDeviceCount(t, homes, first.ID, 2)
+}
@@ -0,0 +1,109 @@
+// Package router dispatches API Gateway requests to device routes so the
+// whole HTTP API can be served by a single Lambda function.
+package router
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/handlers"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+type Router struct {
+	routes []handlers.Route
+	logger *zap.Logger
+}
+
+func New(routes []handlers.Route, logger *zap.Logger) *Router {
+	return &Router{
+		routes: routes,
+		logger: logger,
+	}
+}
+
+// Handle routes request by HTTPMethod and Resource. Behind a "{proxy+}"
+// resource API Gateway does not resolve the route, so the request Path is
+// matched against each route's resource template instead and the path
+// parameters are filled in.
+func (r *Router) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var allowed []string
+
+	for _, route := range r.routes {
+		params, ok := r.match(route, request)
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(route.Method, request.HTTPMethod) {
+			allowed = append(allowed, route.Method)
+			continue
+		}
+
+		if params != nil {
+			request.PathParameters = params
+		}
+		request.Resource = route.Resource
+
+		return route.Handler(ctx, request)
+	}
+
+	if len(allowed) > 0 {
+		r.logger.Warn("method not allowed",
+			zap.String("method", request.HTTPMethod),
+			zap.String("path", request.Path),
+		)
+		sort.Strings(allowed)
+		response := errors.ErrMethodNotAllowed.ToResponse()
+		response.Headers["Allow"] = strings.Join(allowed, ", ")
+		return response, nil
+	}
+
+	r.logger.Warn("route not found",
+		zap.String("method", request.HTTPMethod),
+		zap.String("resource", request.Resource),
+		zap.String("path", request.Path),
+	)
+	return errors.ErrRouteNotFound.ToResponse(), nil
+}
+
+// match reports whether request addresses route. It returns the path
+// parameters extracted from the request path when matching by template.
+func (r *Router) match(route handlers.Route, request events.APIGatewayProxyRequest) (map[string]string, bool) {
+	if request.Resource == route.Resource {
+		return nil, true
+	}
+	return matchPath(route.Resource, request.Path)
+}
+
+// matchPath matches a path such as "/devices/123" against a resource
+// template such as "/devices/{id}"
+func matchPath(template, path string) (map[string]string, bool) {
+	templateParts := splitPath(template)
+	pathParts := splitPath(path)
+	if len(templateParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range templateParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(part, "{}")] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"example.com/smart-devices/internal/handlers"
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+func newTestRouter(got *events.APIGatewayProxyRequest) *Router {
+	record := func(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		*got = request
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	}
+	return New([]handlers.Route{
+		{Method: "GET", Resource: "/devices", Handler: record},
+		{Method: "GET", Resource: "/devices/{id}", Handler: record},
+		{Method: "PUT", Resource: "/devices/{id}", Handler: record},
+	}, zap.NewNop())
+}
+
+func TestRouter_MatchesResource(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	r := newTestRouter(&got)
+
+	resp, _ := r.Handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:     "PUT",
+		Resource:       "/devices/{id}",
+		Path:           "/devices/abc",
+		PathParameters: map[string]string{"id": "abc"},
+	})
+
+	if resp.StatusCode != 200 || got.PathParameters["id"] != "abc" {
+		t.Errorf("Expected PUT /devices/{id} to be routed, got status %d and params %v", resp.StatusCode, got.PathParameters)
+	}
+}
+
+func TestRouter_MatchesProxyPath(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	r := newTestRouter(&got)
+
+	resp, _ := r.Handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:     "GET",
+		Resource:       "/{proxy+}",
+		Path:           "/devices/abc/",
+		PathParameters: map[string]string{"proxy": "devices/abc/"},
+	})
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if got.Resource != "/devices/{id}" || got.PathParameters["id"] != "abc" {
+		t.Errorf("Expected resource /devices/{id} with id=abc, got %s %v", got.Resource, got.PathParameters)
+	}
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	r := newTestRouter(&got)
+
+	resp, _ := r.Handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Resource:   "/{proxy+}",
+		Path:       "/gadgets",
+	})
+
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	r := newTestRouter(&got)
+
+	resp, _ := r.Handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "DELETE",
+		Resource:   "/{proxy+}",
+		Path:       "/devices/abc",
+	})
+
+	if resp.StatusCode != 405 {
+		t.Fatalf("Expected status 405, got %d", resp.StatusCode)
+	}
+	if resp.Headers["Allow"] != "GET, PUT" {
+		t.Errorf("Expected Allow header 'GET, PUT', got %q", resp.Headers["Allow"])
+	}
+}
@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"example.com/smart-devices/internal/clock"
 	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/idgen"
 	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/publisher"
 	"go.uber.org/zap"
 )
 
@@ -11,24 +14,38 @@ import (
 // Both *repository.DeviceRepository and *MockDeviceRepository satisfy this.
 type DeviceRepository interface {
 	GetDevice(ctx context.Context, id string) (*models.Device, error)
-	GetDevices(ctx context.Context) ([]models.Device, error)
+	GetDevices(ctx context.Context, limit int32, nextToken string) (*models.DevicePage, error)
+	GetDevicesByHome(ctx context.Context, homeID string) ([]models.Device, error)
 	CreateDevice(ctx context.Context, device models.Device) (models.Device, error)
-	UpdateDevice(ctx context.Context, id string, device models.Device) (*models.Device, error)
-	DeleteDevice(ctx context.Context, id string) error
-	UpdateDeviceHomeID(ctx context.Context, id, homeID string) error
+	UpdateDevice(ctx context.Context, id string, device models.Device, expectedVersion *int64) (*models.DeviceChange, error)
+	DeleteDevice(ctx context.Context, id string, expectedVersion *int64) (*models.DeviceChange, error)
+	RestoreDevice(ctx context.Context, id string) (*models.Device, error)
+	UpdateDeviceHomeID(ctx context.Context, id, homeID string) (*models.DeviceChange, error)
 }
 
 type DeviceService struct {
-	repo   DeviceRepository
-	logger *zap.Logger
+	repo      DeviceRepository
+	publisher EventPublisher
+	history   DeviceHistoryRepository
+	homes     HomeRepository
+	clock     clock.Clock
+	ids       idgen.IDGenerator
+	logger    *zap.Logger
 }
 
 // NewDeviceService accepts any DeviceRepository (mock or real).
-func NewDeviceService(repo DeviceRepository, logger *zap.Logger) *DeviceService {
-	return &DeviceService{
-		repo:   repo,
-		logger: logger,
+func NewDeviceService(repo DeviceRepository, logger *zap.Logger, opts ...DeviceServiceOption) *DeviceService {
+	s := &DeviceService{
+		repo:      repo,
+		publisher: publisher.Noop{},
+		clock:     clock.SystemClock{},
+		ids:       idgen.UUIDGenerator{},
+		logger:    logger,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *DeviceService) GetDevice(ctx context.Context, id string) (*models.Device, error) {
@@ -70,12 +87,20 @@ func (s *DeviceService) GetDevice(ctx context.Context, id string) (*models.Devic
 	return device, nil
 }
 
-func (s *DeviceService) GetDevices(ctx context.Context) ([]models.Device, error) {
+func (s *DeviceService) GetDevices(ctx context.Context, limit int32, nextToken string) (*models.DevicePage, error) {
 	s.logger.Debug("fetching devices",
+		zap.Int32("limit", limit),
 		zap.String("layer", "service"),
 	)
 
-	devices, err := s.repo.GetDevices(ctx)
+	if limit < 0 {
+		return nil, errors.NewDomainError(errors.ErrorTypeValidation, "limit must not be negative").
+			WithOperation("GetDevices").
+			WithLayer("service").
+			WithContext("limit", limit)
+	}
+
+	page, err := s.repo.GetDevices(ctx, limit, nextToken)
 	if err != nil {
 		// Check if it's already a domain error and preserve it
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -95,23 +120,64 @@ func (s *DeviceService) GetDevices(ctx context.Context) ([]models.Device, error)
 			WithLayer("service")
 	}
 
+	return page, nil
+}
+
+func (s *DeviceService) GetDevicesByHome(ctx context.Context, homeID string) ([]models.Device, error) {
+	s.logger.Debug("fetching devices by home",
+		zap.String("home_id", homeID),
+		zap.String("layer", "service"),
+	)
+
+	if homeID == "" {
+		return nil, errors.ErrDomainMissingHomeID.
+			WithOperation("GetDevicesByHome").
+			WithLayer("service")
+	}
+
+	devices, err := s.repo.GetDevicesByHome(ctx, homeID)
+	if err != nil {
+		// Check if it's already a domain error and preserve it
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			s.logger.Warn("devices by home retrieval failed",
+				zap.String("home_id", homeID),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.Error(err),
+			)
+			return nil, domainErr.WithLayer("service")
+		}
+
+		// Wrap unknown errors
+		s.logger.Warn("devices by home retrieval failed",
+			zap.String("home_id", homeID),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to retrieve devices by home", err).
+			WithOperation("GetDevicesByHome").
+			WithLayer("service").
+			WithContext("home_id", homeID)
+	}
+
 	return devices, nil
 }
 
-func (s *DeviceService) DeleteDevice(ctx context.Context, id string) error {
+// DeleteDevice soft-deletes a device and returns it as deleted. A device that
+// does not exist or is already deleted is not found. When expectedVersion is
+// non-nil the delete only succeeds if the stored device is still at that version.
+func (s *DeviceService) DeleteDevice(ctx context.Context, id string, expectedVersion *int64) (*models.Device, error) {
 	s.logger.Debug("deleting device",
 		zap.String("device_id", id),
 		zap.String("layer", "service"),
 	)
 
 	if id == "" {
-		return errors.ErrDomainInvalidDeviceID.
+		return nil, errors.ErrDomainInvalidDeviceID.
 			WithOperation("DeleteDevice").
 			WithLayer("service").
 			WithContext("reason", "device ID is empty")
 	}
 
-	err := s.repo.DeleteDevice(ctx, id)
+	change, err := s.repo.DeleteDevice(ctx, id, expectedVersion)
 	if err != nil {
 		// Check if it's already a domain error and preserve it
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -120,7 +186,7 @@ func (s *DeviceService) DeleteDevice(ctx context.Context, id string) error {
 				zap.String("error_type", string(domainErr.Type)),
 				zap.Error(err),
 			)
-			return domainErr.WithLayer("service")
+			return nil, domainErr.WithLayer("service")
 		}
 
 		// Wrap unknown errors
@@ -128,16 +194,63 @@ func (s *DeviceService) DeleteDevice(ctx context.Context, id string) error {
 			zap.String("device_id", id),
 			zap.Error(err),
 		)
-		return errors.WrapError(errors.ErrorTypeInternal, "failed to delete device", err).
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to delete device", err).
 			WithOperation("DeleteDevice").
 			WithLayer("service").
 			WithContext("device_id", id)
 	}
 
-	return nil
+	s.publish(ctx, models.EventDeviceDeleted, id, change.Before, nil)
+
+	return change.After, nil
+}
+
+// RestoreDevice undoes the soft delete of a device whose tombstone has not
+// been purged yet and returns the restored device
+func (s *DeviceService) RestoreDevice(ctx context.Context, id string) (*models.Device, error) {
+	s.logger.Debug("restoring device",
+		zap.String("device_id", id),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return nil, errors.ErrDomainInvalidDeviceID.
+			WithOperation("RestoreDevice").
+			WithLayer("service").
+			WithContext("reason", "device ID is empty")
+	}
+
+	restored, err := s.repo.RestoreDevice(ctx, id)
+	if err != nil {
+		// Check if it's already a domain error and preserve it
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			s.logger.Warn("device restore failed",
+				zap.String("device_id", id),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.Error(err),
+			)
+			return nil, domainErr.WithLayer("service")
+		}
+
+		// Wrap unknown errors
+		s.logger.Warn("device restore failed",
+			zap.String("device_id", id),
+			zap.Error(err),
+		)
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to restore device", err).
+			WithOperation("RestoreDevice").
+			WithLayer("service").
+			WithContext("device_id", id)
+	}
+
+	s.publish(ctx, models.EventDeviceRestored, id, nil, restored)
+
+	return restored, nil
 }
 
-func (s *DeviceService) UpdateDevice(ctx context.Context, id string, device models.Device) (*models.Device, error) {
+// UpdateDevice applies the non-empty fields of device. When expectedVersion is
+// non-nil the update only succeeds if the stored device is still at that version.
+func (s *DeviceService) UpdateDevice(ctx context.Context, id string, device models.Device, expectedVersion *int64) (*models.Device, error) {
 	s.logger.Debug("updating device",
 		zap.String("device_id", id),
 		zap.String("layer", "service"),
@@ -150,7 +263,11 @@ func (s *DeviceService) UpdateDevice(ctx context.Context, id string, device mode
 			WithContext("reason", "device ID is empty")
 	}
 
-	updatedDevice, err := s.repo.UpdateDevice(ctx, id, device)
+	if err := s.checkHome(ctx, "UpdateDevice", device.HomeID); err != nil {
+		return nil, err
+	}
+
+	change, err := s.repo.UpdateDevice(ctx, id, device, expectedVersion)
 	if err != nil {
 		// Check if it's already a domain error and preserve it
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -173,7 +290,12 @@ func (s *DeviceService) UpdateDevice(ctx context.Context, id string, device mode
 			WithContext("device_id", id)
 	}
 
-	return updatedDevice, nil
+	s.publish(ctx, models.EventDeviceUpdated, id, change.Before, change.After)
+	if change.Before.HomeID != change.After.HomeID {
+		s.publish(ctx, models.EventDeviceHomeChanged, id, change.Before, change.After)
+	}
+
+	return change.After, nil
 }
 
 func (s *DeviceService) CreateDevice(ctx context.Context, device models.Device) (models.Device, error) {
@@ -183,6 +305,10 @@ func (s *DeviceService) CreateDevice(ctx context.Context, device models.Device)
 		zap.String("layer", "service"),
 	)
 
+	if err := s.checkHome(ctx, "CreateDevice", device.HomeID); err != nil {
+		return device, err
+	}
+
 	createdDevice, err := s.repo.CreateDevice(ctx, device)
 	if err != nil {
 		// Check if it's already a domain error and preserve it
@@ -206,6 +332,8 @@ func (s *DeviceService) CreateDevice(ctx context.Context, device models.Device)
 			WithContext("device_mac", device.MAC)
 	}
 
+	s.publish(ctx, models.EventDeviceCreated, createdDevice.ID, nil, &createdDevice)
+
 	return createdDevice, nil
 }
 
@@ -230,7 +358,11 @@ func (s *DeviceService) UpdateDeviceHomeID(ctx context.Context, id string, homeI
 			WithContext("device_id", id)
 	}
 
-	err := s.repo.UpdateDeviceHomeID(ctx, id, homeID)
+	if err := s.checkHome(ctx, "UpdateDeviceHomeID", homeID); err != nil {
+		return err
+	}
+
+	change, err := s.repo.UpdateDeviceHomeID(ctx, id, homeID)
 	if err != nil {
 		// Check if it's already a domain error and preserve it
 		if domainErr, ok := err.(*errors.DomainError); ok {
@@ -256,5 +388,50 @@ func (s *DeviceService) UpdateDeviceHomeID(ctx context.Context, id string, homeI
 			WithContext("home_id", homeID)
 	}
 
+	s.publish(ctx, models.EventDeviceHomeChanged, id, change.Before, change.After)
+
+	return nil
+}
+
+// UnassignDeviceHome removes a device from its home
+func (s *DeviceService) UnassignDeviceHome(ctx context.Context, id string) error {
+	s.logger.Debug("unassigning device home",
+		zap.String("device_id", id),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return errors.ErrDomainInvalidDeviceID.
+			WithOperation("UnassignDeviceHome").
+			WithLayer("service").
+			WithContext("reason", "device ID is empty")
+	}
+
+	// The repository treats an empty home ID as "no home"
+	change, err := s.repo.UpdateDeviceHomeID(ctx, id, "")
+	if err != nil {
+		// Check if it's already a domain error and preserve it
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			s.logger.Warn("device home unassignment failed",
+				zap.String("device_id", id),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.Error(err),
+			)
+			return domainErr.WithLayer("service")
+		}
+
+		// Wrap unknown errors
+		s.logger.Warn("device home unassignment failed",
+			zap.String("device_id", id),
+			zap.Error(err),
+		)
+		return errors.WrapError(errors.ErrorTypeInternal, "failed to unassign device home", err).
+			WithOperation("UnassignDeviceHome").
+			WithLayer("service").
+			WithContext("device_id", id)
+	}
+
+	s.publish(ctx, models.EventDeviceHomeChanged, id, change.Before, change.After)
+
 	return nil
 }
@@ -6,19 +6,29 @@ import (
 	"testing"
 	"time"
 
+	domainerrors "example.com/smart-devices/internal/errors"
 	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/pkg/testsupport"
 	"go.uber.org/zap"
 )
 
 // MockDeviceRepository implements the repository interface for testing
 type MockDeviceRepository struct {
 	devices map[string]*models.Device
+	deleted map[string]*models.Device
 	err     error
+	clock   *testsupport.FakeClock
+	ids     *testsupport.SequentialIDGenerator
 }
 
 func NewMockDeviceRepository() *MockDeviceRepository {
+	clock := testsupport.NewFakeClock(testsupport.DefaultTime)
+	clock.Step = time.Millisecond
 	return &MockDeviceRepository{
 		devices: make(map[string]*models.Device),
+		deleted: make(map[string]*models.Device),
+		clock:   clock,
+		ids:     testsupport.NewSequentialIDGenerator(),
 	}
 }
 
@@ -28,12 +38,12 @@ func (m *MockDeviceRepository) GetDevice(_ context.Context, id string) (*models.
 	}
 	device, exists := m.devices[id]
 	if !exists {
-		return nil, errors.New("device not found")
+		return nil, domainerrors.ErrDomainDeviceNotFound
 	}
 	return device, nil
 }
 
-func (m *MockDeviceRepository) GetDevices(_ context.Context) ([]models.Device, error) {
+func (m *MockDeviceRepository) GetDevices(_ context.Context, _ int32, _ string) (*models.DevicePage, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -41,6 +51,19 @@ func (m *MockDeviceRepository) GetDevices(_ context.Context) ([]models.Device, e
 	for _, device := range m.devices {
 		devices = append(devices, *device)
 	}
+	return &models.DevicePage{Items: devices}, nil
+}
+
+func (m *MockDeviceRepository) GetDevicesByHome(_ context.Context, homeID string) ([]models.Device, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var devices []models.Device
+	for _, device := range m.devices {
+		if device.HomeID == homeID {
+			devices = append(devices, *device)
+		}
+	}
 	return devices, nil
 }
 
@@ -48,21 +71,27 @@ func (m *MockDeviceRepository) CreateDevice(_ context.Context, device models.Dev
 	if m.err != nil {
 		return device, m.err
 	}
-	device.ID = "test-id-123"
-	device.CreatedAt = time.Now().UnixMilli()
+	device.ID = m.ids.NewID()
+	device.CreatedAt = m.clock.Now().UnixMilli()
 	device.ModifiedAt = device.CreatedAt
+	device.Version = 1
 	m.devices[device.ID] = &device
 	return device, nil
 }
 
-func (m *MockDeviceRepository) UpdateDevice(_ context.Context, id string, device models.Device) (*models.Device, error) {
+func (m *MockDeviceRepository) UpdateDevice(_ context.Context, id string, device models.Device, expectedVersion *int64) (*models.DeviceChange, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 	existing, exists := m.devices[id]
 	if !exists {
-		return nil, errors.New("device not found")
+		return nil, domainerrors.ErrDomainDeviceNotFound
+	}
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return nil, domainerrors.ErrDomainVersionMismatch
 	}
+	before := *existing
+	existing.Version++
 
 	// Update fields
 	if device.Name != "" {
@@ -75,43 +104,68 @@ func (m *MockDeviceRepository) UpdateDevice(_ context.Context, id string, device
 		existing.HomeID = device.HomeID
 	}
 	// Ensure ModifiedAt is always greater than the original
-	now := time.Now().UnixMilli()
+	now := m.clock.Now().UnixMilli()
 	if now <= existing.ModifiedAt {
 		now = existing.ModifiedAt + 1
 	}
 	existing.ModifiedAt = now
 
-	return existing, nil
+	return &models.DeviceChange{Before: &before, After: existing}, nil
 }
 
-func (m *MockDeviceRepository) DeleteDevice(_ context.Context, id string) error {
+func (m *MockDeviceRepository) DeleteDevice(_ context.Context, id string, expectedVersion *int64) (*models.DeviceChange, error) {
 	if m.err != nil {
-		return m.err
+		return nil, m.err
 	}
-	_, exists := m.devices[id]
+	existing, exists := m.devices[id]
 	if !exists {
-		return errors.New("device not found")
+		return nil, domainerrors.ErrDomainDeviceNotFound
+	}
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return nil, domainerrors.ErrDomainVersionMismatch
 	}
+	before := *existing
+	existing.Version++
+	m.deleted[id] = existing
 	delete(m.devices, id)
-	return nil
+	return &models.DeviceChange{Before: &before, After: existing}, nil
+}
+
+func (m *MockDeviceRepository) RestoreDevice(_ context.Context, id string) (*models.Device, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if _, exists := m.devices[id]; exists {
+		return nil, domainerrors.ErrDomainDeviceNotDeleted
+	}
+	device, exists := m.deleted[id]
+	if !exists {
+		return nil, domainerrors.ErrDomainDeviceNotFound
+	}
+	device.Version++
+	m.devices[id] = device
+	delete(m.deleted, id)
+	return device, nil
 }
 
-func (m *MockDeviceRepository) UpdateDeviceHomeID(_ context.Context, id string, homeID string) error {
+func (m *MockDeviceRepository) UpdateDeviceHomeID(_ context.Context, id string, homeID string) (*models.DeviceChange, error) {
 	if m.err != nil {
-		return m.err
+		return nil, m.err
 	}
 	device, exists := m.devices[id]
 	if !exists {
-		return errors.New("device not found")
+		return nil, domainerrors.ErrDomainDeviceNotFound
 	}
+	before := *device
 	device.HomeID = homeID
+	device.Version++
 	// Ensure ModifiedAt is always greater than the original
-	now := time.Now().UnixMilli()
+	now := m.clock.Now().UnixMilli()
 	if now <= device.ModifiedAt {
 		now = device.ModifiedAt + 1
 	}
 	device.ModifiedAt = now
-	return nil
+	return &models.DeviceChange{Before: &before, After: device}, nil
 }
 
 func (m *MockDeviceRepository) SetError(err error) {
@@ -189,8 +243,13 @@ func TestDeviceService_GetDevice_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := service.GetDevice(ctx, "non-existent-id")
-	if err == nil {
-		t.Error("Expected error for non-existent device")
+	if !errors.Is(err, domainerrors.ErrDomainDeviceNotFound) {
+		t.Fatalf("Expected device not found error, got %v", err)
+	}
+
+	var domainErr *domainerrors.DomainError
+	if !errors.As(err, &domainErr) || domainErr.StatusCode != 404 {
+		t.Errorf("Expected a 404 domain error, got %v", err)
 	}
 }
 
@@ -217,7 +276,7 @@ func TestDeviceService_UpdateDevice(t *testing.T) {
 		Type: "light",
 	}
 
-	updatedDevice, err := service.UpdateDevice(ctx, createdDevice.ID, updateDevice)
+	updatedDevice, err := service.UpdateDevice(ctx, createdDevice.ID, updateDevice, nil)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -253,16 +312,25 @@ func TestDeviceService_DeleteDevice(t *testing.T) {
 	createdDevice, _ := service.CreateDevice(ctx, device)
 
 	// Delete the device
-	err := service.DeleteDevice(ctx, createdDevice.ID)
+	deleted, err := service.DeleteDevice(ctx, createdDevice.ID, nil)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if deleted.ID != createdDevice.ID {
+		t.Errorf("Expected deleted device %s, got %+v", createdDevice.ID, deleted)
+	}
 
 	// Verify device is deleted
 	_, err = service.GetDevice(ctx, createdDevice.ID)
 	if err == nil {
 		t.Error("Expected error when getting deleted device")
 	}
+
+	// A second delete finds nothing to delete
+	_, err = service.DeleteDevice(ctx, createdDevice.ID, nil)
+	if !errors.Is(err, domainerrors.ErrDomainDeviceNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
 }
 
 func TestDeviceService_UpdateDeviceHomeID(t *testing.T) {
@@ -303,3 +371,228 @@ func TestDeviceService_UpdateDeviceHomeID(t *testing.T) {
 		t.Error("Expected ModifiedAt to be updated")
 	}
 }
+
+func TestDeviceService_GetDevices_NegativeLimit(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockRepo := NewMockDeviceRepository()
+	service := NewDeviceService(mockRepo, logger)
+
+	_, err := service.GetDevices(context.Background(), -1, "")
+	if err == nil {
+		t.Error("Expected error for negative limit")
+	}
+}
+
+func TestDeviceService_UpdateDevice_VersionMismatch(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	mockRepo := NewMockDeviceRepository()
+	service := NewDeviceService(mockRepo, logger)
+
+	ctx := context.Background()
+
+	device := models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "thermostat",
+		HomeID: "test-home-id",
+	}
+
+	createdDevice, _ := service.CreateDevice(ctx, device)
+
+	staleVersion := createdDevice.Version
+	if _, err := service.UpdateDevice(ctx, createdDevice.ID, models.Device{Name: "First"}, &staleVersion); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err := service.UpdateDevice(ctx, createdDevice.ID, models.Device{Name: "Second"}, &staleVersion)
+	if !errors.Is(err, domainerrors.ErrDomainVersionMismatch) {
+		t.Errorf("Expected version mismatch error, got %v", err)
+	}
+}
+
+// recordingPublisher keeps published events for assertions
+type recordingPublisher struct {
+	events []models.DeviceEvent
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event models.DeviceEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestDeviceService_PublishesEvents(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	publisher := &recordingPublisher{}
+	service := NewDeviceService(mockRepo, zap.NewNop(),
+		WithPublisher(publisher),
+		WithEventClock(testsupport.NewFakeClock(testsupport.DefaultTime)),
+		WithEventIDGenerator(testsupport.NewSequentialIDGenerator()),
+	)
+
+	ctx := context.Background()
+
+	created, err := service.CreateDevice(ctx, models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "thermostat",
+		HomeID: "home-1",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.UpdateDevice(ctx, created.ID, models.Device{Name: "Renamed"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.UpdateDevice(ctx, created.ID, models.Device{HomeID: "home-2"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := service.UnassignDeviceHome(ctx, created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.DeleteDevice(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	wantTypes := []string{
+		models.EventDeviceCreated,
+		models.EventDeviceUpdated,
+		models.EventDeviceUpdated,
+		models.EventDeviceHomeChanged,
+		models.EventDeviceHomeChanged,
+		models.EventDeviceDeleted,
+	}
+	if len(publisher.events) != len(wantTypes) {
+		t.Fatalf("Expected %d events, got %+v", len(wantTypes), publisher.events)
+	}
+	for i, want := range wantTypes {
+		event := publisher.events[i]
+		if event.Type != want || event.DeviceID != created.ID || event.ID == "" || event.OccurredAt != testsupport.DefaultTime.UnixMilli() {
+			t.Errorf("Event %d: expected %s for %s, got %+v", i, want, created.ID, event)
+		}
+	}
+
+	if first := publisher.events[0]; first.Before != nil || first.After == nil || first.After.Name != "Test Device" {
+		t.Errorf("Expected created event with only an after image, got %+v", first)
+	}
+	if renamed := publisher.events[1]; renamed.Before.Name != "Test Device" || renamed.After.Name != "Renamed" {
+		t.Errorf("Expected before/after names on update, got %+v -> %+v", renamed.Before, renamed.After)
+	}
+	if moved := publisher.events[3]; moved.Before.HomeID != "home-1" || moved.After.HomeID != "home-2" {
+		t.Errorf("Expected home change from home-1 to home-2, got %+v -> %+v", moved.Before, moved.After)
+	}
+	if unassigned := publisher.events[4]; unassigned.Before.HomeID != "home-2" || unassigned.After.HomeID != "" {
+		t.Errorf("Expected home change to no home, got %+v -> %+v", unassigned.Before, unassigned.After)
+	}
+	if deleted := publisher.events[5]; deleted.Before == nil || deleted.After != nil {
+		t.Errorf("Expected deleted event with only a before image, got %+v", deleted)
+	}
+
+	// Deleting a missing device changes nothing and publishes nothing
+	_, _ = service.DeleteDevice(ctx, created.ID, nil)
+	if len(publisher.events) != len(wantTypes) {
+		t.Errorf("Expected no event for a missing device, got %+v", publisher.events[len(wantTypes):])
+	}
+
+	restored, err := service.RestoreDevice(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	last := publisher.events[len(publisher.events)-1]
+	if last.Type != models.EventDeviceRestored || last.Before != nil || last.After == nil || last.After.Version != restored.Version {
+		t.Errorf("Expected restored event with only an after image, got %+v", last)
+	}
+}
+
+// concurrentWriter renames a device on every read, like another writer
+// changing it between the service's write and a read
+type concurrentWriter struct {
+	*MockDeviceRepository
+}
+
+func (r concurrentWriter) GetDevice(ctx context.Context, id string) (*models.Device, error) {
+	if _, err := r.MockDeviceRepository.UpdateDevice(ctx, id, models.Device{Name: "Other Writer"}, nil); err != nil {
+		return nil, err
+	}
+	return r.MockDeviceRepository.GetDevice(ctx, id)
+}
+
+func TestDeviceService_EventsCarryWrittenImages(t *testing.T) {
+	repo := concurrentWriter{NewMockDeviceRepository()}
+	publisher := &recordingPublisher{}
+	service := NewDeviceService(repo, zap.NewNop(), WithPublisher(publisher))
+
+	ctx := context.Background()
+	created, err := service.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Test Device", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := service.UpdateDeviceHomeID(ctx, created.ID, "home-2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := service.UnassignDeviceHome(ctx, created.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.DeleteDevice(ctx, created.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, event := range publisher.events {
+		for _, image := range []*models.Device{event.Before, event.After} {
+			if image != nil && image.Name != "Test Device" {
+				t.Errorf("Expected %s images as written, got name %s", event.Type, image.Name)
+			}
+		}
+	}
+}
+
+// staticHistory serves fixed history entries, oldest first
+type staticHistory struct {
+	entries []models.DeviceHistoryEntry
+}
+
+func (h *staticHistory) GetHistory(_ context.Context, deviceID string, _ int32, _ string) (*models.DeviceHistoryPage, error) {
+	page := &models.DeviceHistoryPage{Items: []models.DeviceHistoryEntry{}}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if h.entries[i].DeviceID == deviceID {
+			page.Items = append(page.Items, h.entries[i])
+		}
+	}
+	return page, nil
+}
+
+func TestDeviceService_GetDeviceHistory(t *testing.T) {
+	mockRepo := NewMockDeviceRepository()
+	created, err := mockRepo.CreateDevice(context.Background(), models.Device{MAC: "00:11:22:33:44:55", Name: "Test Device", Type: "thermostat"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history := &staticHistory{entries: []models.DeviceHistoryEntry{
+		{DeviceID: created.ID, ID: "entry-1", Type: models.EventDeviceCreated},
+		{DeviceID: created.ID, ID: "entry-2", Type: models.EventDeviceUpdated},
+		{DeviceID: "other", ID: "entry-3", Type: models.EventDeviceCreated},
+	}}
+	service := NewDeviceService(mockRepo, zap.NewNop(), WithHistory(history))
+
+	page, err := service.GetDeviceHistory(context.Background(), created.ID, 10, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 2 || page.Items[0].ID != "entry-2" || page.Items[1].ID != "entry-1" {
+		t.Errorf("Expected the device's entries newest first, got %+v", page.Items)
+	}
+
+	// A device without entries, e.g. from before history, has an empty one
+	history.entries = nil
+	page, err = service.GetDeviceHistory(context.Background(), created.ID, 10, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Items) != 0 {
+		t.Errorf("Expected no entries, got %+v", page.Items)
+	}
+
+	// A device that never existed has no history and answers not found
+	if _, err := service.GetDeviceHistory(context.Background(), "missing", 10, ""); err == nil {
+		t.Error("Expected error for an unknown device")
+	}
+}
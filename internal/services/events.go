@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+
+	"example.com/smart-devices/internal/clock"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/models"
+	"go.uber.org/zap"
+)
+
+// EventPublisher delivers device lifecycle events to downstream consumers
+type EventPublisher interface {
+	Publish(ctx context.Context, event models.DeviceEvent) error
+}
+
+// DeviceServiceOption overrides a default dependency of DeviceService
+type DeviceServiceOption func(*DeviceService)
+
+// WithPublisher makes DeviceService publish an event for every change. The
+// default publisher.Noop discards them.
+func WithPublisher(p EventPublisher) DeviceServiceOption {
+	return func(s *DeviceService) {
+		s.publisher = p
+	}
+}
+
+// WithEventClock replaces the wall clock used for event timestamps
+func WithEventClock(c clock.Clock) DeviceServiceOption {
+	return func(s *DeviceService) {
+		s.clock = c
+	}
+}
+
+// WithEventIDGenerator replaces the UUID generator used for event IDs
+func WithEventIDGenerator(g idgen.IDGenerator) DeviceServiceOption {
+	return func(s *DeviceService) {
+		s.ids = g
+	}
+}
+
+// publish sends an event for a change that has already been stored. A failed
+// publish cannot undo the change, so it is logged and not returned.
+// The images are copied so a caller that changes the device the service
+// returned cannot change the event.
+func (s *DeviceService) publish(ctx context.Context, eventType string, id string, before *models.Device, after *models.Device) {
+	event := models.DeviceEvent{
+		ID:         s.ids.NewID(),
+		Type:       eventType,
+		DeviceID:   id,
+		OccurredAt: clock.NowMillis(s.clock),
+		Before:     image(before),
+		After:      image(after),
+	}
+
+	if err := s.publisher.Publish(ctx, event); err != nil {
+		s.logger.Error("failed to publish device event",
+			zap.String("event_id", event.ID),
+			zap.String("event_type", eventType),
+			zap.String("device_id", id),
+			zap.Error(err),
+		)
+	}
+}
+
+// image returns a copy of device, or nil for no device
+func image(device *models.Device) *models.Device {
+	if device == nil {
+		return nil
+	}
+	copied := *device
+	return &copied
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"go.uber.org/zap"
+)
+
+// DeviceHistoryRepository reads the append-only change history of devices.
+// The DeviceRepository records the entries in the same write as each change,
+// from the images it replaced and wrote. GetHistory returns a device's
+// entries newest first.
+type DeviceHistoryRepository interface {
+	GetHistory(ctx context.Context, deviceID string, limit int32, nextToken string) (*models.DeviceHistoryPage, error)
+}
+
+// WithHistory makes DeviceService serve device history from h
+func WithHistory(h DeviceHistoryRepository) DeviceServiceOption {
+	return func(s *DeviceService) {
+		s.history = h
+	}
+}
+
+// GetDeviceHistory returns a page of the device's change history, newest
+// first. History outlives the device, so deleted devices still have one.
+func (s *DeviceService) GetDeviceHistory(ctx context.Context, id string, limit int32, nextToken string) (*models.DeviceHistoryPage, error) {
+	s.logger.Debug("fetching device history",
+		zap.String("device_id", id),
+		zap.Int32("limit", limit),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return nil, errors.ErrDomainInvalidDeviceID.
+			WithOperation("GetDeviceHistory").
+			WithLayer("service").
+			WithContext("reason", "device ID is empty")
+	}
+	if s.history == nil {
+		return nil, errors.NewDomainError(errors.ErrorTypeInternal, "device history is not configured").
+			WithOperation("GetDeviceHistory").
+			WithLayer("service")
+	}
+
+	page, err := s.history.GetHistory(ctx, id, limit, nextToken)
+	if err != nil {
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			s.logger.Warn("device history retrieval failed",
+				zap.String("device_id", id),
+				zap.String("error_type", string(domainErr.Type)),
+				zap.Error(err),
+			)
+			return nil, domainErr.WithLayer("service")
+		}
+
+		return nil, errors.WrapError(errors.ErrorTypeInternal, "failed to retrieve device history", err).
+			WithOperation("GetDeviceHistory").
+			WithLayer("service").
+			WithContext("device_id", id)
+	}
+
+	// A device without history either never existed or predates history;
+	// only the first answers 404
+	if len(page.Items) == 0 && nextToken == "" {
+		if _, err := s.GetDevice(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
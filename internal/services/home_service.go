@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	stderrors "errors"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"go.uber.org/zap"
+)
+
+// homeUpdateAttempts bounds how often an update without If-Match is retried
+// when the home changes between the read and the write
+const homeUpdateAttempts = 3
+
+// HomeRepository stores homes. UpdateHome replaces the stored home only if it
+// is still at home.Version and returns it with the version bumped.
+type HomeRepository interface {
+	GetHome(ctx context.Context, id string) (*models.Home, error)
+	GetHomes(ctx context.Context, limit int32, nextToken string) (*models.HomePage, error)
+	CreateHome(ctx context.Context, home models.Home) (models.Home, error)
+	UpdateHome(ctx context.Context, home models.Home) (*models.Home, error)
+	DeleteHome(ctx context.Context, id string, expectedVersion *int64) error
+}
+
+// WithHomes makes DeviceService reject devices assigned to a home that does
+// not exist
+func WithHomes(h HomeRepository) DeviceServiceOption {
+	return func(s *DeviceService) {
+		s.homes = h
+	}
+}
+
+// checkHome fails with ErrDomainUnknownHome when homeID is set but no such
+// home exists. Without a home repository every home is accepted. It answers
+// early and covers dry runs, which write nothing; the device repository
+// checks the home again in the same transaction as the write, which is what
+// rules out a home deleted in between.
+func (s *DeviceService) checkHome(ctx context.Context, operation string, homeID string) error {
+	if s.homes == nil || homeID == "" {
+		return nil
+	}
+
+	_, err := s.homes.GetHome(ctx, homeID)
+	if err == nil {
+		return nil
+	}
+	if stderrors.Is(err, errors.ErrDomainHomeNotFound) {
+		return errors.ErrDomainUnknownHome.
+			WithOperation(operation).
+			WithLayer("service").
+			WithContext("home_id", homeID)
+	}
+	if domainErr, ok := err.(*errors.DomainError); ok {
+		return domainErr.WithLayer("service")
+	}
+	return errors.WrapError(errors.ErrorTypeInternal, "failed to look up home", err).
+		WithOperation(operation).
+		WithLayer("service").
+		WithContext("home_id", homeID)
+}
+
+type HomeService struct {
+	homes   HomeRepository
+	devices DeviceRepository
+	logger  *zap.Logger
+}
+
+// NewHomeService creates the home service. devices is consulted so that a
+// home is only deleted once no device is assigned to it.
+func NewHomeService(homes HomeRepository, devices DeviceRepository, logger *zap.Logger) *HomeService {
+	return &HomeService{
+		homes:   homes,
+		devices: devices,
+		logger:  logger,
+	}
+}
+
+func (s *HomeService) GetHome(ctx context.Context, id string) (*models.Home, error) {
+	s.logger.Debug("fetching home",
+		zap.String("home_id", id),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return nil, errors.ErrDomainInvalidHomeID.
+			WithOperation("GetHome").
+			WithLayer("service").
+			WithContext("reason", "home ID is empty")
+	}
+
+	home, err := s.homes.GetHome(ctx, id)
+	if err != nil {
+		return nil, s.wrap(err, "GetHome", "failed to retrieve home", id)
+	}
+	return home, nil
+}
+
+func (s *HomeService) GetHomes(ctx context.Context, limit int32, nextToken string) (*models.HomePage, error) {
+	s.logger.Debug("fetching homes",
+		zap.Int32("limit", limit),
+		zap.String("layer", "service"),
+	)
+
+	page, err := s.homes.GetHomes(ctx, limit, nextToken)
+	if err != nil {
+		return nil, s.wrap(err, "GetHomes", "failed to retrieve homes", "")
+	}
+	return page, nil
+}
+
+// CreateHome stores a new home. A home without an owner belongs to the actor
+// making the request.
+func (s *HomeService) CreateHome(ctx context.Context, home models.Home) (models.Home, error) {
+	if home.Owner == "" {
+		home.Owner = audit.FromContext(ctx).ID
+	}
+
+	s.logger.Debug("creating home",
+		zap.String("name", home.Name),
+		zap.String("owner", home.Owner),
+		zap.String("layer", "service"),
+	)
+
+	created, err := s.homes.CreateHome(ctx, home)
+	if err != nil {
+		return home, s.wrap(err, "CreateHome", "failed to create home", "")
+	}
+
+	s.logger.Info("home created", zap.String("home_id", created.ID))
+	return created, nil
+}
+
+// UpdateHome applies the fields set in update. When expectedVersion is non-nil
+// the update only succeeds if the stored home is still at that version;
+// otherwise a concurrent change is retried.
+func (s *HomeService) UpdateHome(ctx context.Context, id string, update models.UpdateHomeRequest, expectedVersion *int64) (*models.Home, error) {
+	s.logger.Debug("updating home",
+		zap.String("home_id", id),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return nil, errors.ErrDomainInvalidHomeID.
+			WithOperation("UpdateHome").
+			WithLayer("service").
+			WithContext("reason", "home ID is empty")
+	}
+
+	for attempt := 1; ; attempt++ {
+		home, err := s.homes.GetHome(ctx, id)
+		if err != nil {
+			return nil, s.wrap(err, "UpdateHome", "failed to update home", id)
+		}
+		if expectedVersion != nil && home.Version != *expectedVersion {
+			return nil, errors.ErrDomainHomeVersionMismatch.
+				WithOperation("UpdateHome").
+				WithLayer("service").
+				WithContext("home_id", id).
+				WithContext("expected_version", *expectedVersion)
+		}
+
+		if update.Name != nil {
+			home.Name = *update.Name
+		}
+		if update.Address != nil {
+			home.Address = *update.Address
+		}
+		if update.Timezone != nil {
+			home.Timezone = *update.Timezone
+		}
+		if update.Owner != nil {
+			home.Owner = *update.Owner
+		}
+
+		updated, err := s.homes.UpdateHome(ctx, *home)
+		if err == nil {
+			return updated, nil
+		}
+		if expectedVersion == nil && attempt < homeUpdateAttempts && stderrors.Is(err, errors.ErrDomainHomeVersionMismatch) {
+			s.logger.Debug("home changed during update, retrying",
+				zap.String("home_id", id),
+				zap.Int("attempt", attempt),
+			)
+			continue
+		}
+		return nil, s.wrap(err, "UpdateHome", "failed to update home", id)
+	}
+}
+
+// DeleteHome removes a home. It fails with ErrDomainHomeNotEmpty while devices
+// are still assigned to the home. The homeId index is only eventually
+// consistent, so the repository also refuses the delete while the home's
+// device count, kept in the same transaction as every assignment, is above
+// zero.
+func (s *HomeService) DeleteHome(ctx context.Context, id string, expectedVersion *int64) error {
+	s.logger.Debug("deleting home",
+		zap.String("home_id", id),
+		zap.String("layer", "service"),
+	)
+
+	if id == "" {
+		return errors.ErrDomainInvalidHomeID.
+			WithOperation("DeleteHome").
+			WithLayer("service").
+			WithContext("reason", "home ID is empty")
+	}
+
+	devices, err := s.devices.GetDevicesByHome(ctx, id)
+	if err != nil && !stderrors.Is(err, errors.ErrDomainNoDevicesFound) {
+		return s.wrap(err, "DeleteHome", "failed to delete home", id)
+	}
+	if len(devices) > 0 {
+		return errors.ErrDomainHomeNotEmpty.
+			WithOperation("DeleteHome").
+			WithLayer("service").
+			WithContext("home_id", id).
+			WithContext("device_count", len(devices))
+	}
+
+	if err := s.homes.DeleteHome(ctx, id, expectedVersion); err != nil {
+		return s.wrap(err, "DeleteHome", "failed to delete home", id)
+	}
+
+	s.logger.Info("home deleted", zap.String("home_id", id))
+	return nil
+}
+
+// wrap preserves domain errors and wraps anything else as an internal error
+func (s *HomeService) wrap(err error, operation string, message string, id string) error {
+	if domainErr, ok := err.(*errors.DomainError); ok {
+		s.logger.Warn("home operation failed",
+			zap.String("operation", operation),
+			zap.String("home_id", id),
+			zap.String("error_type", string(domainErr.Type)),
+			zap.Error(err),
+		)
+		return domainErr.WithLayer("service")
+	}
+
+	s.logger.Warn("home operation failed",
+		zap.String("operation", operation),
+		zap.String("home_id", id),
+		zap.Error(err),
+	)
+	return errors.WrapError(errors.ErrorTypeInternal, message, err).
+		WithOperation(operation).
+		WithLayer("service").
+		WithContext("home_id", id)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"example.com/smart-devices/internal/audit"
+	domainerrors "example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"go.uber.org/zap"
+)
+
+// fakeHomeRepository keeps homes in a map; only the version is checked on
+// writes
+type fakeHomeRepository struct {
+	homes map[string]models.Home
+}
+
+func newFakeHomeRepository(ids ...string) *fakeHomeRepository {
+	r := &fakeHomeRepository{homes: make(map[string]models.Home)}
+	for _, id := range ids {
+		r.homes[id] = models.Home{ID: id, Name: id, Timezone: "UTC", Version: 1}
+	}
+	return r
+}
+
+func (r *fakeHomeRepository) GetHome(_ context.Context, id string) (*models.Home, error) {
+	home, ok := r.homes[id]
+	if !ok {
+		return nil, domainerrors.ErrDomainHomeNotFound
+	}
+	return &home, nil
+}
+
+func (r *fakeHomeRepository) GetHomes(_ context.Context, _ int32, _ string) (*models.HomePage, error) {
+	page := &models.HomePage{}
+	for _, home := range r.homes {
+		page.Items = append(page.Items, home)
+	}
+	return page, nil
+}
+
+func (r *fakeHomeRepository) CreateHome(_ context.Context, home models.Home) (models.Home, error) {
+	home.ID = "home-" + home.Name
+	home.Version = 1
+	r.homes[home.ID] = home
+	return home, nil
+}
+
+func (r *fakeHomeRepository) UpdateHome(_ context.Context, home models.Home) (*models.Home, error) {
+	stored, ok := r.homes[home.ID]
+	if !ok {
+		return nil, domainerrors.ErrDomainHomeNotFound
+	}
+	if stored.Version != home.Version {
+		return nil, domainerrors.ErrDomainHomeVersionMismatch
+	}
+	home.Version++
+	r.homes[home.ID] = home
+	return &home, nil
+}
+
+func (r *fakeHomeRepository) DeleteHome(_ context.Context, id string, _ *int64) error {
+	if _, ok := r.homes[id]; !ok {
+		return domainerrors.ErrDomainHomeNotFound
+	}
+	delete(r.homes, id)
+	return nil
+}
+
+func TestDeviceService_RejectsUnknownHome(t *testing.T) {
+	ctx := context.Background()
+	service := NewDeviceService(NewMockDeviceRepository(), zap.NewNop(), WithHomes(newFakeHomeRepository("home-1")))
+
+	_, err := service.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Sensor", Type: "sensor", HomeID: "home-2"})
+	if !errors.Is(err, domainerrors.ErrDomainUnknownHome) {
+		t.Fatalf("Expected unknown home error, got %v", err)
+	}
+
+	created, err := service.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Sensor", Type: "sensor", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := service.UpdateDevice(ctx, created.ID, models.Device{HomeID: "home-2"}, nil); !errors.Is(err, domainerrors.ErrDomainUnknownHome) {
+		t.Errorf("Expected unknown home error from UpdateDevice, got %v", err)
+	}
+	if err := service.UpdateDeviceHomeID(ctx, created.ID, "home-2"); !errors.Is(err, domainerrors.ErrDomainUnknownHome) {
+		t.Errorf("Expected unknown home error from UpdateDeviceHomeID, got %v", err)
+	}
+	if _, err := service.UpdateDevice(ctx, created.ID, models.Device{Name: "Renamed"}, nil); err != nil {
+		t.Errorf("Expected update without a home to succeed, got %v", err)
+	}
+}
+
+func TestHomeService_CreateHome_DefaultsOwner(t *testing.T) {
+	service := NewHomeService(newFakeHomeRepository(), NewMockDeviceRepository(), zap.NewNop())
+	ctx := audit.WithActor(context.Background(), audit.Actor{ID: "user-1", Source: models.SourceHTTP})
+
+	created, err := service.CreateHome(ctx, models.Home{Name: "Cabin", Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created.Owner != "user-1" {
+		t.Errorf("Expected owner user-1, got %q", created.Owner)
+	}
+}
+
+func TestHomeService_UpdateHome_VersionMismatch(t *testing.T) {
+	service := NewHomeService(newFakeHomeRepository("home-1"), NewMockDeviceRepository(), zap.NewNop())
+	name := "Renamed"
+	stale := int64(2)
+
+	_, err := service.UpdateHome(context.Background(), "home-1", models.UpdateHomeRequest{Name: &name}, &stale)
+	if !errors.Is(err, domainerrors.ErrDomainHomeVersionMismatch) {
+		t.Fatalf("Expected version mismatch, got %v", err)
+	}
+
+	updated, err := service.UpdateHome(context.Background(), "home-1", models.UpdateHomeRequest{Name: &name}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Name != name || updated.Version != 2 {
+		t.Errorf("Expected renamed home at version 2, got %+v", updated)
+	}
+}
+
+func TestHomeService_DeleteHome_NotEmpty(t *testing.T) {
+	ctx := context.Background()
+	homes := newFakeHomeRepository("home-1")
+	devices := NewMockDeviceRepository()
+	service := NewHomeService(homes, devices, zap.NewNop())
+
+	device, err := devices.CreateDevice(ctx, models.Device{MAC: "00:11:22:33:44:55", Name: "Sensor", Type: "sensor", HomeID: "home-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := service.DeleteHome(ctx, "home-1", nil); !errors.Is(err, domainerrors.ErrDomainHomeNotEmpty) {
+		t.Fatalf("Expected home not empty error, got %v", err)
+	}
+
+	if _, err := devices.DeleteDevice(ctx, device.ID, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := service.DeleteHome(ctx, "home-1", nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := homes.homes["home-1"]; ok {
+		t.Error("Expected home to be deleted")
+	}
+}
@@ -3,37 +3,265 @@ package services
 import (
 	"context"
 	"encoding/json"
+
+	"example.com/smart-devices/internal/audit"
+	"example.com/smart-devices/internal/errors"
 	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/validation"
 	"go.uber.org/zap"
 )
 
+// defaultSQSActor is recorded in the device history for messages without an
+// actor
+const defaultSQSActor = "sqs-listener"
+
+// ActionHandler applies a single SQS message for the action it is registered under
+type ActionHandler func(ctx context.Context, message models.SQSMessage) error
+
+// ClaimStatus is the outcome of MessageDedupStore.Claim
+type ClaimStatus int
+
+const (
+	// ClaimAcquired means the caller now holds the claim and processes the key
+	ClaimAcquired ClaimStatus = iota
+	// ClaimDone means the key has already been processed
+	ClaimDone
+	// ClaimInFlight means another delivery holds a claim whose lease has not
+	// yet expired; its outcome is still unknown
+	ClaimInFlight
+)
+
+// MessageDedupStore remembers which messages have been processed so that SQS
+// redeliveries are applied at most once.
+type MessageDedupStore interface {
+	// Claim reserves key for processing unless it is already processed or
+	// claimed by another delivery
+	Claim(ctx context.Context, key string) (ClaimStatus, error)
+	// Complete marks a claimed key as processed for the retention period
+	Complete(ctx context.Context, key string) error
+	// Release gives up a claim so a later delivery can process the key again
+	Release(ctx context.Context, key string) error
+}
+
+// registeredAction pairs an action's handler with the validator its messages
+// must pass first
+type registeredAction struct {
+	handler  ActionHandler
+	validate validation.SQSMessageValidator
+}
+
 type SQSService struct {
 	deviceService *DeviceService
+	dedup         MessageDedupStore
+	actions       map[string]registeredAction
 	logger        *zap.Logger
 }
 
-func NewSQSService(deviceService *DeviceService, logger *zap.Logger) *SQSService {
-	return &SQSService{
+// NewSQSService creates the SQS message processor. dedup may be nil to
+// process every delivery.
+func NewSQSService(deviceService *DeviceService, dedup MessageDedupStore, logger *zap.Logger) *SQSService {
+	s := &SQSService{
 		deviceService: deviceService,
+		dedup:         dedup,
+		actions:       make(map[string]registeredAction),
 		logger:        logger,
 	}
+
+	s.RegisterAction(models.ActionAssignHome, s.assignHome, validation.ValidateHomeAssignmentMessage)
+	s.RegisterAction(models.ActionAssociate, s.assignHome, validation.ValidateHomeAssignmentMessage)
+	s.RegisterAction(models.ActionUnassignHome, s.unassignHome, validation.ValidateDeviceMessage)
+	s.RegisterAction(models.ActionRename, s.rename, validation.ValidateRenameMessage)
+	s.RegisterAction(models.ActionDelete, s.delete, validation.ValidateDeviceMessage)
+	s.RegisterAction(models.ActionCreate, s.create, validation.ValidateCreateMessage)
+
+	return s
+}
+
+// RegisterAction replaces the handler for action. Messages for action are
+// checked by validation.ValidateSQSMessage with validate before the handler
+// runs; messages for actions that were never registered are rejected.
+func (s *SQSService) RegisterAction(action string, handler ActionHandler, validate validation.SQSMessageValidator) {
+	s.actions[action] = registeredAction{handler: handler, validate: validate}
+}
+
+// HandleRecord processes one SQS record and decides whether it should be
+// retried. Permanent failures (see errors.IsPermanent) are logged with
+// failure_class=permanent and dropped by returning nil, since redelivering
+// them can only fail again; transient failures are returned for SQS to retry.
+// Records already handled by an earlier delivery are skipped; records another
+// delivery is still processing are returned for retry, since that delivery
+// may yet fail.
+func (s *SQSService) HandleRecord(ctx context.Context, messageID string, body string) error {
+	key := dedupKey(messageID, body)
+
+	if s.dedup != nil {
+		status, err := s.dedup.Claim(ctx, key)
+		if err != nil {
+			s.logger.Warn("message will be retried after transient failure",
+				zap.String("message-id", messageID),
+				zap.String("failure_class", "transient"),
+				zap.Error(err),
+			)
+			return err
+		}
+		switch status {
+		case ClaimDone:
+			s.logger.Info("skipping duplicate message", zap.String("message-id", messageID), zap.String("dedup-key", key))
+			return nil
+		case ClaimInFlight:
+			s.logger.Warn("message will be retried while another delivery processes it",
+				zap.String("message-id", messageID),
+				zap.String("dedup-key", key),
+				zap.String("failure_class", "transient"),
+			)
+			return errors.ErrMessageInFlight.
+				WithOperation("HandleRecord").
+				WithLayer("service").
+				WithContext("dedup_key", key)
+		}
+	}
+
+	err := s.ProcessMessage(ctx, body)
+	if err == nil {
+		s.completeDedup(ctx, key)
+		return nil
+	}
+
+	if errors.IsPermanent(err) {
+		// Redeliveries of a permanently failed message are dropped as well
+		s.completeDedup(ctx, key)
+
+		var errorType string
+		if domainErr, ok := err.(*errors.DomainError); ok {
+			errorType = string(domainErr.Type)
+		}
+		s.logger.Warn("dropping message after permanent failure",
+			zap.String("message-id", messageID),
+			zap.String("failure_class", "permanent"),
+			zap.String("error_type", errorType),
+			zap.String("body", body),
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	if s.dedup != nil {
+		if releaseErr := s.dedup.Release(ctx, key); releaseErr != nil {
+			// The claim lease expires on its own before SQS redelivers
+			s.logger.Warn("failed to release message claim", zap.String("dedup-key", key), zap.Error(releaseErr))
+		}
+	}
+
+	s.logger.Warn("message will be retried after transient failure",
+		zap.String("message-id", messageID),
+		zap.String("failure_class", "transient"),
+		zap.Error(err),
+	)
+	return err
+}
+
+// completeDedup records key as processed. A failure only risks reprocessing
+// a redelivery, so it is logged rather than failing the record.
+func (s *SQSService) completeDedup(ctx context.Context, key string) {
+	if s.dedup == nil {
+		return
+	}
+	if err := s.dedup.Complete(ctx, key); err != nil {
+		s.logger.Warn("failed to record processed message", zap.String("dedup-key", key), zap.Error(err))
+	}
 }
 
+// dedupKey prefers the producer-supplied messageId, which stays the same
+// when the producer retries a send, and falls back to the SQS message ID
+func dedupKey(messageID string, body string) string {
+	var message models.SQSMessage
+	if err := json.Unmarshal([]byte(body), &message); err == nil && message.MessageID != "" {
+		return message.MessageID
+	}
+	return messageID
+}
+
+// ProcessMessage applies a single message and returns any failure unclassified
 func (s *SQSService) ProcessMessage(ctx context.Context, msg string) error {
 	var message models.SQSMessage
 
 	if err := json.Unmarshal([]byte(msg), &message); err != nil {
 		s.logger.Error("failed to unmarshal message", zap.Error(err))
+		return errors.WrapError(errors.ErrorTypeValidation, "malformed message body", err).
+			WithOperation("ProcessMessage").
+			WithLayer("service")
+	}
+
+	action := message.Action
+	if action == "" {
+		action = models.ActionAssignHome
+	}
+
+	registered, ok := s.actions[action]
+	if !ok {
+		s.logger.Error("unknown message action",
+			zap.String("action", message.Action),
+			zap.String("device-id", message.DeviceID),
+		)
+		return errors.ErrDomainUnknownAction.
+			WithOperation("ProcessMessage").
+			WithLayer("service").
+			WithContext("action", message.Action)
+	}
+
+	// Reject bad IDs and unsupported schema versions before any database
+	// access
+	if err := validation.ValidateSQSMessage(message, registered.validate); err != nil {
+		s.logger.Error("invalid message", zap.String("action", message.Action), zap.String("device-id", message.DeviceID), zap.Error(err))
 		return err
 	}
 
-	s.logger.Info("processing device-home association", zap.String("device-id", message.DeviceID), zap.String("home-id", message.HomeID))
+	s.logger.Info("processing device message", zap.String("action", action), zap.String("device-id", message.DeviceID))
+
+	actor := message.Actor
+	if actor == "" {
+		actor = defaultSQSActor
+	}
+	ctx = audit.WithActor(ctx, audit.Actor{ID: actor, Source: models.SourceSQS})
 
-	if err := s.deviceService.UpdateDeviceHomeID(ctx, message.DeviceID, message.HomeID); err != nil {
-		s.logger.Error("failed to update device-home association", zap.Error(err), zap.String("device-id", message.DeviceID), zap.String("home-id", message.HomeID))
+	if err := registered.handler(ctx, message); err != nil {
+		s.logger.Error("failed to process device message", zap.Error(err), zap.String("action", action), zap.String("device-id", message.DeviceID))
 		return err
 	}
-	s.logger.Info("device-home association updated", zap.String("device-id", message.DeviceID), zap.String("home-id", message.HomeID))
+	s.logger.Info("device message processed", zap.String("action", action), zap.String("device-id", message.DeviceID))
 	return nil
+}
+
+func (s *SQSService) assignHome(ctx context.Context, message models.SQSMessage) error {
+	return s.deviceService.UpdateDeviceHomeID(ctx, message.DeviceID, message.HomeID)
+}
+
+func (s *SQSService) unassignHome(ctx context.Context, message models.SQSMessage) error {
+	return s.deviceService.UnassignDeviceHome(ctx, message.DeviceID)
+}
+
+func (s *SQSService) rename(ctx context.Context, message models.SQSMessage) error {
+	_, err := s.deviceService.UpdateDevice(ctx, message.DeviceID, models.Device{Name: message.Name}, nil)
+	return err
+}
 
+func (s *SQSService) delete(ctx context.Context, message models.SQSMessage) error {
+	_, err := s.deviceService.DeleteDevice(ctx, message.DeviceID, nil)
+	return err
+}
+
+func (s *SQSService) create(ctx context.Context, message models.SQSMessage) error {
+	device := models.Device{
+		MAC:    message.MAC,
+		Name:   message.Name,
+		Type:   message.Type,
+		HomeID: message.HomeID,
+	}
+
+	created, err := s.deviceService.CreateDevice(ctx, device)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("device created from message", zap.String("device-id", created.ID), zap.String("device-mac", created.MAC))
+	return nil
 }
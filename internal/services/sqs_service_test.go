@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainerrors "example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+	"example.com/smart-devices/internal/validation"
+	"go.uber.org/zap"
+)
+
+func newTestSQSService(t *testing.T) (*SQSService, *MockDeviceRepository, models.Device) {
+	t.Helper()
+
+	logger, _ := zap.NewDevelopment()
+	mockRepo := NewMockDeviceRepository()
+	deviceService := NewDeviceService(mockRepo, logger)
+
+	device, err := deviceService.CreateDevice(context.Background(), models.Device{
+		MAC:    "00:11:22:33:44:55",
+		Name:   "Test Device",
+		Type:   "thermostat",
+		HomeID: "11111111-1111-4111-8111-111111111111",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	return NewSQSService(deviceService, nil, logger), mockRepo, device
+}
+
+func TestSQSService_ProcessMessage_Actions(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		msg   func(id string) string
+		check func(t *testing.T, repo *MockDeviceRepository, id string)
+	}{
+		{
+			name: "missing action assigns home",
+			msg: func(id string) string {
+				return `{"deviceId":"` + id + `","homeId":"22222222-2222-4222-8222-222222222222"}`
+			},
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if repo.devices[id].HomeID != "22222222-2222-4222-8222-222222222222" {
+					t.Errorf("Expected 22222222-2222-4222-8222-222222222222, got %s", repo.devices[id].HomeID)
+				}
+			},
+		},
+		{
+			name: "assign_home",
+			msg: func(id string) string {
+				return `{"action":"assign_home","deviceId":"` + id + `","homeId":"33333333-3333-4333-8333-333333333333"}`
+			},
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if repo.devices[id].HomeID != "33333333-3333-4333-8333-333333333333" {
+					t.Errorf("Expected 33333333-3333-4333-8333-333333333333, got %s", repo.devices[id].HomeID)
+				}
+			},
+		},
+		{
+			name: "legacy associate",
+			msg: func(id string) string {
+				return `{"action":"associate","deviceId":"` + id + `","homeId":"44444444-4444-4444-8444-444444444444"}`
+			},
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if repo.devices[id].HomeID != "44444444-4444-4444-8444-444444444444" {
+					t.Errorf("Expected 44444444-4444-4444-8444-444444444444, got %s", repo.devices[id].HomeID)
+				}
+			},
+		},
+		{
+			name: "unassign_home",
+			msg:  func(id string) string { return `{"action":"unassign_home","deviceId":"` + id + `"}` },
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if repo.devices[id].HomeID != "" {
+					t.Errorf("Expected no home, got %s", repo.devices[id].HomeID)
+				}
+			},
+		},
+		{
+			name: "rename",
+			msg:  func(id string) string { return `{"action":"rename","deviceId":"` + id + `","name":"Kitchen"}` },
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if repo.devices[id].Name != "Kitchen" {
+					t.Errorf("Expected name Kitchen, got %s", repo.devices[id].Name)
+				}
+			},
+		},
+		{
+			name: "delete",
+			msg:  func(id string) string { return `{"action":"delete","deviceId":"` + id + `"}` },
+			check: func(t *testing.T, repo *MockDeviceRepository, id string) {
+				if _, exists := repo.devices[id]; exists {
+					t.Error("Expected device to be deleted")
+				}
+			},
+		},
+		{
+			name: "create",
+			msg: func(string) string {
+				return `{"action":"create","mac":"AA:BB:CC:DD:EE:FF","name":"New","type":"light","homeId":"11111111-1111-4111-8111-111111111111"}`
+			},
+			check: func(t *testing.T, repo *MockDeviceRepository, _ string) {
+				if len(repo.devices) != 2 {
+					t.Errorf("Expected 2 devices, got %d", len(repo.devices))
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, repo, device := newTestSQSService(t)
+
+			if err := service.ProcessMessage(ctx, tt.msg(device.ID)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			tt.check(t, repo, device.ID)
+		})
+	}
+}
+
+func TestSQSService_ProcessMessage_UnknownAction(t *testing.T) {
+	service, _, device := newTestSQSService(t)
+
+	err := service.ProcessMessage(context.Background(), `{"action":"explode","deviceId":"`+device.ID+`"}`)
+	if !errors.Is(err, domainerrors.ErrDomainUnknownAction) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+}
+
+func TestSQSService_RegisterAction_CustomAction(t *testing.T) {
+	service, _, device := newTestSQSService(t)
+	ctx := context.Background()
+
+	var handled []string
+	service.RegisterAction("reboot", func(_ context.Context, message models.SQSMessage) error {
+		handled = append(handled, message.DeviceID)
+		return nil
+	}, validation.ValidateDeviceMessage)
+
+	if err := service.ProcessMessage(ctx, `{"action":"reboot","deviceId":"`+device.ID+`"}`); err != nil {
+		t.Fatalf("Expected registered action to be accepted, got %v", err)
+	}
+	if len(handled) != 1 || handled[0] != device.ID {
+		t.Errorf("Expected handler to run for %s, got %v", device.ID, handled)
+	}
+
+	// The validator registered with the action still guards its handler
+	err := service.ProcessMessage(ctx, `{"action":"reboot","deviceId":"not-a-uuid"}`)
+	var domainErr *domainerrors.DomainError
+	if !errors.As(err, &domainErr) || domainErr.Type != domainerrors.ErrorTypeValidation {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+	if len(handled) != 1 {
+		t.Errorf("Expected invalid message not to reach the handler, got %v", handled)
+	}
+}
+
+func TestSQSService_ProcessMessage_RenameRequiresName(t *testing.T) {
+	service, repo, device := newTestSQSService(t)
+
+	err := service.ProcessMessage(context.Background(), `{"action":"rename","deviceId":"`+device.ID+`"}`)
+	if !errors.Is(err, domainerrors.ErrDomainMissingName) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+	if repo.devices[device.ID].Name != device.Name {
+		t.Error("Expected device to be unchanged")
+	}
+}
+
+func TestSQSService_HandleRecord_ClassifiesFailures(t *testing.T) {
+	service, repo, device := newTestSQSService(t)
+	ctx := context.Background()
+
+	permanent := map[string]string{
+		"malformed":      "{",
+		"unknown action": `{"action":"explode","deviceId":"` + device.ID + `"}`,
+		"missing name":   `{"action":"rename","deviceId":"` + device.ID + `"}`,
+	}
+	for name, body := range permanent {
+		if err := service.HandleRecord(ctx, name, body); err != nil {
+			t.Errorf("%s: expected permanent failure to be dropped, got %v", name, err)
+		}
+	}
+
+	repo.SetError(domainerrors.NewDomainError(domainerrors.ErrorTypeDatabase, "throttled"))
+	if err := service.HandleRecord(ctx, "transient", `{"deviceId":"`+device.ID+`","homeId":"22222222-2222-4222-8222-222222222222"}`); err == nil {
+		t.Error("Expected transient failure to be returned for retry")
+	}
+}
+
+// stubDedupStore answers every claim with status and records Complete calls
+type stubDedupStore struct {
+	status    ClaimStatus
+	completed []string
+}
+
+func (s *stubDedupStore) Claim(_ context.Context, _ string) (ClaimStatus, error) {
+	return s.status, nil
+}
+
+func (s *stubDedupStore) Complete(_ context.Context, key string) error {
+	s.completed = append(s.completed, key)
+	return nil
+}
+
+func (s *stubDedupStore) Release(_ context.Context, _ string) error {
+	return nil
+}
+
+func TestSQSService_HandleRecord_ClaimStatus(t *testing.T) {
+	_, repo, device := newTestSQSService(t)
+	logger, _ := zap.NewDevelopment()
+	deviceService := NewDeviceService(repo, logger)
+	ctx := context.Background()
+	body := `{"action":"rename","deviceId":"` + device.ID + `","name":"Kitchen"}`
+
+	tests := []struct {
+		name        string
+		status      ClaimStatus
+		wantErr     bool
+		wantApplied bool
+	}{
+		{name: "acquired", status: ClaimAcquired, wantErr: false, wantApplied: true},
+		{name: "done", status: ClaimDone, wantErr: false, wantApplied: false},
+		// The other delivery may still fail, so this one must not be acked
+		{name: "in flight", status: ClaimInFlight, wantErr: true, wantApplied: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := repo.GetDevice(ctx, device.ID)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			version := before.Version
+
+			dedup := &stubDedupStore{status: tt.status}
+			err = NewSQSService(deviceService, dedup, logger).HandleRecord(ctx, "m-1", body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr && domainerrors.IsPermanent(err) {
+				t.Errorf("Expected a retryable error, got %v", err)
+			}
+
+			after, err := repo.GetDevice(ctx, device.ID)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if applied := after.Version != version; applied != tt.wantApplied {
+				t.Errorf("Expected message applied %v, got %v", tt.wantApplied, applied)
+			}
+			if completed := len(dedup.completed) > 0; completed != tt.wantApplied {
+				t.Errorf("Expected message completed %v, got %v", tt.wantApplied, completed)
+			}
+		})
+	}
+}
+
+func TestSQSService_ProcessMessage_ValidatesBeforeDatabase(t *testing.T) {
+	service, repo, device := newTestSQSService(t)
+	ctx := context.Background()
+
+	// Any repository call would surface this database error instead of a
+	// validation error
+	repo.SetError(domainerrors.NewDomainError(domainerrors.ErrorTypeDatabase, "unexpected database access"))
+
+	invalid := map[string]string{
+		"device ID not a UUID": `{"action":"assign_home","deviceId":"not-a-uuid","homeId":"11111111-1111-4111-8111-111111111111"}`,
+		"home ID not a UUID":   `{"action":"assign_home","deviceId":"` + device.ID + `","homeId":"home"}`,
+		"missing home ID":      `{"deviceId":"` + device.ID + `"}`,
+		"future schema":        `{"schemaVersion":2,"action":"delete","deviceId":"` + device.ID + `"}`,
+		"invalid create":       `{"action":"create","mac":"nope","name":"x","type":"toaster","homeId":"11111111-1111-4111-8111-111111111111"}`,
+	}
+	for name, body := range invalid {
+		err := service.ProcessMessage(ctx, body)
+		var domainErr *domainerrors.DomainError
+		if !errors.As(err, &domainErr) || domainErr.Type != domainerrors.ErrorTypeValidation {
+			t.Errorf("%s: expected validation error, got %v", name, err)
+		}
+	}
+}
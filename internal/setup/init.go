@@ -2,27 +2,221 @@ package setup
 
 import (
 	"context"
+	"example.com/smart-devices/internal/clock"
 	appConfig "example.com/smart-devices/internal/config"
 	"example.com/smart-devices/internal/handlers"
+	"example.com/smart-devices/internal/idgen"
+	"example.com/smart-devices/internal/outbox"
+	"example.com/smart-devices/internal/publisher"
 	"example.com/smart-devices/internal/repository"
+	"example.com/smart-devices/internal/repository/memory"
 	"example.com/smart-devices/internal/services"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 )
 
+// options holds the dependencies that callers of SetupComponents may override
+type options struct {
+	clock clock.Clock
+	ids   idgen.IDGenerator
+}
+
+// Option overrides a default dependency of SetupComponents
+type Option func(*options)
+
+// WithClock replaces the wall clock used for device timestamps
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithIDGenerator replaces the UUID generator used for new device IDs
+func WithIDGenerator(g idgen.IDGenerator) Option {
+	return func(o *options) {
+		o.ids = g
+	}
+}
+
 // SetupComponents initializes all common components and returns handlers and logger
-func SetupComponents() (*handlers.DeviceHandler, *handlers.SQSHandler, *zap.Logger) {
+func SetupComponents(opts ...Option) (*handlers.DeviceHandler, *handlers.SQSHandler, *zap.Logger) {
+	c := newComponents(opts)
+	return handlers.NewDeviceHandler(c.devices, c.logger), handlers.NewSQSHandler(c.sqs, c.logger), c.logger
+}
+
+// SetupAPIComponents initializes the components behind the HTTP API and
+// returns the device and home handlers and logger
+func SetupAPIComponents(opts ...Option) (*handlers.DeviceHandler, *handlers.HomeHandler, *zap.Logger) {
+	c := newComponents(opts)
+	return handlers.NewDeviceHandler(c.devices, c.logger), handlers.NewHomeHandler(c.homes, c.logger), c.logger
+}
+
+// components holds the services shared by the Setup functions
+type components struct {
+	devices *services.DeviceService
+	homes   *services.HomeService
+	sqs     *services.SQSService
+	logger  *zap.Logger
+}
+
+func newComponents(opts []Option) components {
+	o := options{
+		clock: clock.SystemClock{},
+		ids:   idgen.UUIDGenerator{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg := appConfig.Load()
+	logger := NewLogger()
+
+	// Initialize repository and services
+	stores := newStorage(cfg, o, logger)
+	// With the outbox the relay publishes the events recorded by each write
+	var eventPublisher services.EventPublisher = publisher.Noop{}
+	if !outboxEnabled(cfg) {
+		eventPublisher = newEventPublisher(cfg, logger)
+	}
+	// HOME_CHECKS=false only bridges the window until cmd/backfill-homes has
+	// created the homes that devices from before homes refer to
+	var checkedHomes services.HomeRepository
+	if cfg.HomeChecks {
+		checkedHomes = stores.homes
+	} else {
+		logger.Warn("Home checks disabled, devices may refer to unknown homes and home device counts are not kept")
+	}
+	deviceService := services.NewDeviceService(stores.devices, logger,
+		services.WithPublisher(eventPublisher),
+		services.WithHistory(stores.history),
+		services.WithHomes(checkedHomes),
+		services.WithEventClock(o.clock),
+		services.WithEventIDGenerator(o.ids),
+	)
+
+	return components{
+		devices: deviceService,
+		homes:   services.NewHomeService(stores.homes, stores.devices, logger),
+		sqs:     services.NewSQSService(deviceService, stores.dedup, logger),
+		logger:  logger,
+	}
+}
+
+// storage holds the stores of the configured storage backend
+type storage struct {
+	devices services.DeviceRepository
+	dedup   services.MessageDedupStore
+	history services.DeviceHistoryRepository
+	homes   services.HomeRepository
+}
+
+// newStorage builds the device and home repositories, SQS dedup store and
+// device history for the storage backend configured by STORAGE_BACKEND
+func newStorage(cfg *appConfig.Config, o options, logger *zap.Logger) storage {
+	switch cfg.StorageBackend {
+	case appConfig.StorageMemory:
+		logger.Info("Using in-memory device storage")
+		history := memory.NewHistoryRepository()
+		homes := memory.NewHomeRepository(o.clock, o.ids, logger)
+		repoOpts := []memory.Option{
+			memory.WithTombstoneRetention(cfg.TombstoneRetention),
+			memory.WithHistory(history),
+		}
+		if cfg.HomeChecks {
+			repoOpts = append(repoOpts, memory.WithHomes(homes))
+		}
+		return storage{
+			devices: memory.NewDeviceRepository(o.clock, o.ids, logger, repoOpts...),
+			dedup:   memory.NewDedupStore(o.clock, cfg.DedupLease, cfg.DedupRetention),
+			history: history,
+			homes:   homes,
+		}
+	case appConfig.StorageDynamoDB:
+		dynamoClient := NewDynamoDBClient(cfg, logger)
+		repoOpts := []repository.DeviceRepositoryOption{
+			repository.WithTombstoneRetention(cfg.TombstoneRetention),
+			repository.WithHistory(cfg.HistoryTable),
+		}
+		if cfg.HomeChecks {
+			repoOpts = append(repoOpts, repository.WithHomes(cfg.HomesTable))
+		}
+		if outboxEnabled(cfg) {
+			logger.Info("Recording device events in the outbox", zap.String("table", cfg.OutboxTable))
+			repoOpts = append(repoOpts, repository.WithOutbox(cfg.OutboxTable, cfg.OutboxRetention))
+		}
+		return storage{
+			devices: repository.NewDeviceRepository(dynamoClient, cfg.DynamoDBTable, cfg.MACTable, o.clock, o.ids, logger, repoOpts...),
+			dedup:   repository.NewDedupStore(dynamoClient, cfg.DedupTable, o.clock, cfg.DedupLease, cfg.DedupRetention, logger),
+			history: repository.NewHistoryRepository(dynamoClient, cfg.HistoryTable, logger),
+			homes:   repository.NewHomeRepository(dynamoClient, cfg.HomesTable, o.clock, o.ids, logger),
+		}
+	default:
+		logger.Fatal("unknown storage backend", zap.String("backend", cfg.StorageBackend))
+		return storage{}
+	}
+}
+
+// outboxEnabled reports whether device events go through the outbox table,
+// which only the DynamoDB backend writes
+func outboxEnabled(cfg *appConfig.Config) bool {
+	return cfg.StorageBackend == appConfig.StorageDynamoDB && cfg.OutboxTable != ""
+}
+
+// SetupOutboxRelay builds the relay that publishes outbox entries with the
+// configured event publisher
+func SetupOutboxRelay() (*outbox.Relay, *zap.Logger) {
 	cfg := appConfig.Load()
+	logger := NewLogger()
+
+	if cfg.OutboxTable == "" {
+		logger.Fatal("DYNAMODB_OUTBOX_TABLE must be set for the outbox relay")
+	}
+	if cfg.EventPublisher == appConfig.PublisherNone {
+		logger.Fatal("EVENT_PUBLISHER must not be none for the outbox relay")
+	}
+	eventPublisher := newEventPublisher(cfg, logger)
+
+	store := repository.NewOutboxStore(NewDynamoDBClient(cfg, logger), cfg.OutboxTable, clock.SystemClock{}, logger)
+	return outbox.NewRelay(store, eventPublisher, logger), logger
+}
+
+// newEventPublisher builds the device event publisher configured by
+// EVENT_PUBLISHER
+func newEventPublisher(cfg *appConfig.Config, logger *zap.Logger) services.EventPublisher {
+	switch cfg.EventPublisher {
+	case appConfig.PublisherNone:
+		return publisher.Noop{}
+	case appConfig.PublisherMemory:
+		logger.Info("Publishing device events to memory")
+		return publisher.NewMemoryPublisher()
+	case appConfig.PublisherSQS:
+		if cfg.EventsQueueURL == "" {
+			logger.Fatal("EVENTS_QUEUE_URL must be set when EVENT_PUBLISHER is sqs")
+		}
+		logger.Info("Publishing device events to SQS", zap.String("queue_url", cfg.EventsQueueURL))
+		return publisher.NewSQSPublisher(NewSQSClient(cfg, logger), cfg.EventsQueueURL, logger)
+	default:
+		logger.Fatal("unknown event publisher", zap.String("publisher", cfg.EventPublisher))
+		return nil
+	}
+}
 
-	// Initialize logger
+// NewLogger builds the production logger used by every entrypoint
+func NewLogger() *zap.Logger {
 	loggerCfg := zap.NewProductionConfig()
 	loggerCfg.OutputPaths = []string{"stdout"}
 	logger, err := loggerCfg.Build()
 	if err != nil {
 		panic(err)
 	}
+	return logger
+}
 
+// NewDynamoDBClient creates a DynamoDB client, honoring the custom endpoint
+// used for local development
+func NewDynamoDBClient(cfg *appConfig.Config, logger *zap.Logger) *dynamodb.Client {
 	// Load AWS configuration
 	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(cfg.AWSRegion))
 	if err != nil {
@@ -50,13 +244,23 @@ func SetupComponents() (*handlers.DeviceHandler, *handlers.SQSHandler, *zap.Logg
 		zap.String("region", cfg.AWSRegion),
 	)
 
-	// Initialize repository, services, and handlers
-	deviceRepo := repository.NewDeviceRepository(dynamoClient, cfg.DynamoDBTable, logger)
-	deviceService := services.NewDeviceService(deviceRepo, logger)
-	sqsService := services.NewSQSService(deviceService, logger)
+	return dynamoClient
+}
 
-	deviceHandler := handlers.NewDeviceHandler(deviceService, logger)
-	sqsHandler := handlers.NewSQSHandler(sqsService, logger)
+// NewSQSClient creates an SQS client, honoring the custom endpoint used for
+// a local SQS stand-in
+func NewSQSClient(cfg *appConfig.Config, logger *zap.Logger) *sqs.Client {
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(cfg.AWSRegion))
+	if err != nil {
+		logger.Fatal("failed to load AWS config", zap.Error(err))
+	}
+
+	if cfg.SQSEndpoint != "" {
+		logger.Info("Using custom SQS endpoint", zap.String("url", cfg.SQSEndpoint))
+		return sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+			o.BaseEndpoint = &cfg.SQSEndpoint
+		})
+	}
 
-	return deviceHandler, sqsHandler, logger
+	return sqs.NewFromConfig(awsCfg)
 }
@@ -3,13 +3,24 @@ package validation
 import (
 	"encoding/json"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	// Embedded so time zones validate on Lambda runtimes without zoneinfo
+	_ "time/tzdata"
 
 	"example.com/smart-devices/internal/errors"
 	"example.com/smart-devices/internal/models"
 	"github.com/google/uuid"
 )
 
+const (
+	// DefaultPageLimit is used when a list request does not specify a limit
+	DefaultPageLimit = 50
+	// MaxPageLimit is the largest page size a client may request
+	MaxPageLimit = 100
+)
+
 var (
 	// MAC address regex pattern
 	macRegex = regexp.MustCompile(`^([0-9A-Fa-f]{2}[:-]){5}([0-9A-Fa-f]{2})$`)
@@ -42,6 +53,63 @@ func ValidateDeviceID(deviceID string) error {
 	return nil
 }
 
+// ValidateHomeID validates a home ID parameter
+func ValidateHomeID(homeID string) error {
+	if strings.TrimSpace(homeID) == "" {
+		return errors.ErrMissingHomeID
+	}
+
+	// Check if it's a valid UUID format
+	if _, err := uuid.Parse(homeID); err != nil {
+		return errors.ErrInvalidRequest.WithMessage("Home ID must be a valid UUID")
+	}
+
+	return nil
+}
+
+// ValidateIfMatch parses the If-Match header, if present, into the device
+// version the client expects. It returns nil when no precondition applies
+// (header absent or "*").
+func ValidateIfMatch(headers map[string]string) (*int64, error) {
+	var value string
+	for name, v := range headers {
+		if strings.EqualFold(name, "If-Match") {
+			value = strings.TrimSpace(v)
+			break
+		}
+	}
+
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	value = strings.Trim(value, `"`)
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return nil, errors.ErrInvalidIfMatch
+	}
+
+	return &version, nil
+}
+
+// ValidatePagination validates the limit and nextToken query parameters of a
+// list request and returns the effective page size and token
+func ValidatePagination(params map[string]string) (int32, string, error) {
+	limit := DefaultPageLimit
+
+	if raw, ok := params["limit"]; ok && strings.TrimSpace(raw) != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > MaxPageLimit {
+			return 0, "", errors.ErrValidationFailed.WithMessage("limit must be an integer between 1 and " + strconv.Itoa(MaxPageLimit))
+		}
+		limit = parsed
+	}
+
+	return int32(limit), strings.TrimSpace(params["nextToken"]), nil
+}
+
 // ValidateCreateDeviceRequest validates a create device request
 func ValidateCreateDeviceRequest(req models.CreateDeviceRequest) error {
 	var validationErrors []string
@@ -129,3 +197,147 @@ func ValidateUpdateDeviceRequest(req models.UpdateDeviceRequest) error {
 
 	return nil
 }
+
+// ValidateCreateHomeRequest validates a create home request
+func ValidateCreateHomeRequest(req models.CreateHomeRequest) error {
+	var validationErrors []string
+
+	if req.Name == "" {
+		validationErrors = append(validationErrors, "name is required")
+	} else if len(req.Name) > 100 {
+		validationErrors = append(validationErrors, "name must be between 1 and 100 characters")
+	}
+
+	if len(req.Address) > 200 {
+		validationErrors = append(validationErrors, "address must be at most 200 characters")
+	}
+
+	if req.Timezone == "" {
+		validationErrors = append(validationErrors, "timezone is required")
+	} else if !validTimezone(req.Timezone) {
+		validationErrors = append(validationErrors, "timezone must be an IANA time zone name (e.g. Europe/Berlin)")
+	}
+
+	if len(req.Owner) > 100 {
+		validationErrors = append(validationErrors, "owner must be at most 100 characters")
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.ErrValidationFailed.WithMessage(strings.Join(validationErrors, "; "))
+	}
+
+	return nil
+}
+
+// ValidateUpdateHomeRequest validates an update home request
+func ValidateUpdateHomeRequest(req models.UpdateHomeRequest) error {
+	var validationErrors []string
+
+	if req.Name != nil && (len(*req.Name) < 1 || len(*req.Name) > 100) {
+		validationErrors = append(validationErrors, "name must be between 1 and 100 characters")
+	}
+
+	if req.Address != nil && len(*req.Address) > 200 {
+		validationErrors = append(validationErrors, "address must be at most 200 characters")
+	}
+
+	if req.Timezone != nil && !validTimezone(*req.Timezone) {
+		validationErrors = append(validationErrors, "timezone must be an IANA time zone name (e.g. Europe/Berlin)")
+	}
+
+	if req.Owner != nil && (len(*req.Owner) < 1 || len(*req.Owner) > 100) {
+		validationErrors = append(validationErrors, "owner must be between 1 and 100 characters")
+	}
+
+	// At least one field must be provided for update
+	if req.Name == nil && req.Address == nil && req.Timezone == nil && req.Owner == nil {
+		validationErrors = append(validationErrors, "at least one field (name, address, timezone, or owner) must be provided for update")
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.ErrValidationFailed.WithMessage(strings.Join(validationErrors, "; "))
+	}
+
+	return nil
+}
+
+// validTimezone reports whether tz names an IANA time zone. "Local" and the
+// empty string are accepted by time.LoadLocation but are not zone names.
+func validTimezone(tz string) bool {
+	if tz == "" || tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+// SQSMessageValidator checks the fields one queue message action needs and
+// returns the failures of the HTTP validators it applies
+type SQSMessageValidator func(message models.SQSMessage) []error
+
+// ValidateSQSMessage applies the HTTP validation rules to a queue message: a
+// supported schema version and, through validate, the fields its action
+// needs. validate is registered with the action, so a nil validate checks the
+// schema version only. Unlike the HTTP validators it returns a validation
+// DomainError so queue consumers treat it as permanent.
+func ValidateSQSMessage(message models.SQSMessage, validate SQSMessageValidator) error {
+	var validationErrors []string
+
+	if message.SchemaVersion < 0 || message.SchemaVersion > models.SQSMessageSchemaVersion {
+		validationErrors = append(validationErrors,
+			"schemaVersion "+strconv.Itoa(message.SchemaVersion)+" is not supported (latest is "+strconv.Itoa(models.SQSMessageSchemaVersion)+")")
+	}
+
+	if validate != nil {
+		for _, err := range validate(message) {
+			if err == nil {
+				continue
+			}
+			// Validators registered elsewhere may return plain errors, which
+			// fail the message like the HTTP validators' APIErrors do
+			if apiErr, ok := err.(errors.APIError); ok {
+				validationErrors = append(validationErrors, apiErr.Message)
+			} else {
+				validationErrors = append(validationErrors, err.Error())
+			}
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		return errors.NewDomainError(errors.ErrorTypeValidation, strings.Join(validationErrors, "; ")).
+			WithOperation("ValidateSQSMessage").
+			WithLayer("validation").
+			WithContext("action", message.Action).
+			WithContext("device_id", message.DeviceID)
+	}
+
+	return nil
+}
+
+// ValidateDeviceMessage checks a message addressing an existing device
+func ValidateDeviceMessage(message models.SQSMessage) []error {
+	return []error{ValidateDeviceID(message.DeviceID)}
+}
+
+// ValidateHomeAssignmentMessage checks a message moving a device to a home
+func ValidateHomeAssignmentMessage(message models.SQSMessage) []error {
+	return []error{ValidateDeviceID(message.DeviceID), ValidateHomeID(message.HomeID)}
+}
+
+// ValidateRenameMessage checks a message renaming a device
+func ValidateRenameMessage(message models.SQSMessage) []error {
+	return []error{
+		ValidateDeviceID(message.DeviceID),
+		ValidateUpdateDeviceRequest(models.UpdateDeviceRequest{Name: &message.Name}),
+	}
+}
+
+// ValidateCreateMessage checks a message registering a new device
+func ValidateCreateMessage(message models.SQSMessage) []error {
+	return []error{ValidateCreateDeviceRequest(models.CreateDeviceRequest{
+		MAC:    message.MAC,
+		Name:   message.Name,
+		Type:   message.Type,
+		HomeID: message.HomeID,
+	})}
+}
@@ -0,0 +1,90 @@
+package validation
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"example.com/smart-devices/internal/errors"
+	"example.com/smart-devices/internal/models"
+)
+
+func TestValidatePagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    map[string]string
+		wantLimit int32
+		wantToken string
+		wantErr   bool
+	}{
+		{name: "defaults", params: nil, wantLimit: DefaultPageLimit},
+		{name: "blank limit", params: map[string]string{"limit": " "}, wantLimit: DefaultPageLimit},
+		{name: "smallest limit", params: map[string]string{"limit": "1"}, wantLimit: 1},
+		{name: "largest limit", params: map[string]string{"limit": "100"}, wantLimit: MaxPageLimit},
+		{name: "token is trimmed", params: map[string]string{"nextToken": " abc "}, wantLimit: DefaultPageLimit, wantToken: "abc"},
+		{name: "zero limit", params: map[string]string{"limit": "0"}, wantErr: true},
+		{name: "negative limit", params: map[string]string{"limit": "-5"}, wantErr: true},
+		{name: "limit above maximum", params: map[string]string{"limit": "101"}, wantErr: true},
+		{name: "non-numeric limit", params: map[string]string{"limit": "ten"}, wantErr: true},
+		{name: "fractional limit", params: map[string]string{"limit": "2.5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, token, err := ValidatePagination(tt.params)
+			if tt.wantErr {
+				apiErr, ok := err.(errors.APIError)
+				if !ok || apiErr.StatusCode != 400 {
+					t.Fatalf("Expected a 400 APIError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if limit != tt.wantLimit || token != tt.wantToken {
+				t.Errorf("Expected limit %d and token %q, got %d and %q", tt.wantLimit, tt.wantToken, limit, token)
+			}
+		})
+	}
+}
+
+func TestValidateSQSMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate SQSMessageValidator
+		wantErr  string
+	}{
+		{name: "no validator"},
+		{name: "valid fields", validate: func(models.SQSMessage) []error { return []error{nil, nil} }},
+		{
+			name:     "API error",
+			validate: ValidateDeviceMessage,
+			wantErr:  "Device ID must be a valid UUID",
+		},
+		{
+			name:     "plain error",
+			validate: func(models.SQSMessage) []error { return []error{nil, stderrors.New("firmware is required")} },
+			wantErr:  "firmware is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSQSMessage(models.SQSMessage{Action: "update", DeviceID: "not-a-uuid"}, tt.validate)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			var domainErr *errors.DomainError
+			if !stderrors.As(err, &domainErr) || domainErr.Type != errors.ErrorTypeValidation {
+				t.Fatalf("Expected a validation DomainError, got %v", err)
+			}
+			if domainErr.Message != tt.wantErr {
+				t.Errorf("Expected message %q, got %q", tt.wantErr, domainErr.Message)
+			}
+		})
+	}
+}
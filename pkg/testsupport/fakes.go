@@ -0,0 +1,84 @@
+// Package testsupport provides deterministic implementations of the
+// clock.Clock and idgen.IDGenerator interfaces for tests.
+package testsupport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTime is the instant a FakeClock starts at unless told otherwise
+var DefaultTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FakeClock is a clock.Clock that only moves when told to. If Step is set,
+// every call to Now advances the clock by Step after returning, which keeps
+// successive timestamps strictly increasing without sleeping.
+type FakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	Step time.Duration
+}
+
+// NewFakeClock returns a FakeClock set to start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now
+	c.now = c.now.Add(c.Step)
+	return now
+}
+
+// Set moves the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// SequentialIDGenerator is an idgen.IDGenerator returning valid, predictable
+// UUIDs: 00000000-0000-4000-8000-000000000001, ...-000000000002, and so on
+type SequentialIDGenerator struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// NewSequentialIDGenerator returns a generator whose first ID ends in 1
+func NewSequentialIDGenerator() *SequentialIDGenerator {
+	return &SequentialIDGenerator{next: 1}
+}
+
+// NewID returns the next ID in the sequence
+func (g *SequentialIDGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := fmt.Sprintf("00000000-0000-4000-8000-%012d", g.next)
+	g.next++
+	return id
+}
+
+// FixedIDGenerator is an idgen.IDGenerator that always returns ID
+type FixedIDGenerator struct {
+	ID string
+}
+
+// NewID returns the fixed ID
+func (g FixedIDGenerator) NewID() string {
+	return g.ID
+}
@@ -1,11 +1,13 @@
 #!/bin/bash
 
-echo "🚀 Testing UpdateDeviceHomeID with ModifiedAt update..."
+echo "🚀 Running repository conformance tests against DynamoDB Local..."
 echo ""
 
+DYNAMODB_TEST_URL=${DYNAMODB_TEST_URL:-http://localhost:8000}
+
 # Check if DynamoDB Local is running
-if ! curl -s http://localhost:8000 > /dev/null 2>&1; then
-    echo "❌ DynamoDB Local is not running on localhost:8000"
+if ! curl -s "$DYNAMODB_TEST_URL" > /dev/null 2>&1; then
+    echo "❌ DynamoDB Local is not running on $DYNAMODB_TEST_URL"
     echo "Please start DynamoDB Local with Docker:"
     echo "docker run -p 8000:8000 amazon/dynamodb-local"
     exit 1
@@ -15,8 +17,8 @@ echo "✅ DynamoDB Local is running"
 echo ""
 
 # Run the test
-echo "Running test..."
-go run test_update_home_id.go
+echo "Running tests..."
+DYNAMODB_TEST_URL=$DYNAMODB_TEST_URL go test ./internal/repository/ -run Conformance -v
 
 echo ""
 echo "Test completed!"
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"strconv"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -35,3 +36,17 @@ func JSONSuccessResponse(status int, data interface{}) events.APIGatewayProxyRes
 		},
 	}
 }
+
+// FormatETag renders a device version as a strong ETag header value
+func FormatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// WithETag sets the ETag header of a response to the given version
+func WithETag(resp events.APIGatewayProxyResponse, version int64) events.APIGatewayProxyResponse {
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers["ETag"] = FormatETag(version)
+	return resp
+}